@@ -0,0 +1,207 @@
+// Package audit records who changed which entity in an audit table and offers an endpoint to read the history of an entity.
+//
+// A handler records a change after it was made:
+//
+//	ferr := audit.Record(c, "article", article.ID, audit.ActionUpdate, before, after)
+//
+// Use RecordWith and the *database.Tx of the change to write the entry in the same transaction.
+// The table can be created with EnsureTable or a migration containing CreateTableMySQL.
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/database"
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/users"
+	"github.com/fabiokaelin/ferror"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TableName is the table the entries are written to
+	TableName = "audit_log"
+
+	// ActionCreate is the action for a new entity, before is nil
+	ActionCreate = "create"
+	// ActionUpdate is the action for a changed entity
+	ActionUpdate = "update"
+	// ActionDelete is the action for a removed entity, after is nil
+	ActionDelete = "delete"
+)
+
+// CreateTableMySQL creates the audit table, it can be used in a migration
+const CreateTableMySQL = `CREATE TABLE IF NOT EXISTS ` + TableName + ` (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	entity VARCHAR(100) NOT NULL,
+	entity_id VARCHAR(100) NOT NULL,
+	action VARCHAR(20) NOT NULL,
+	changes JSON NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	request_id VARCHAR(64) NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	INDEX audit_log_entity (entity, entity_id, created_at)
+)`
+
+type (
+	// Entry is a recorded change
+	Entry struct {
+		ID        int64     `db:"id" json:"id"`
+		Entity    string    `db:"entity" json:"entity"`
+		EntityID  string    `db:"entity_id" json:"entityId"`
+		Action    string    `db:"action" json:"action"`
+		Changes   Changes   `db:"changes" json:"changes"`
+		UserID    string    `db:"user_id" json:"userId"`       // empty if the change was not made by a logged in user
+		RequestID string    `db:"request_id" json:"requestId"` // see logger.RequestID
+		CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	}
+
+	// Change is the value of a field before and after a change
+	Change struct {
+		Before any `json:"before"`
+		After  any `json:"after"`
+	}
+
+	// Changes are the changed fields of an entity by their JSON name, it is stored as JSON
+	Changes map[string]Change
+)
+
+// defaultHistoryLimit and maxHistoryLimit bound the number of entries returned by the history endpoint
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// EnsureTable creates the audit table on the default client if it does not exist (mysql only)
+func EnsureTable(ctx context.Context) ferror.FError {
+	_, ferr := database.ExecContext(ctx, CreateTableMySQL)
+	return ferr
+}
+
+// Record records a change of an entity on the default client. The user and the request id are taken from c.
+// before and after are marshalled to JSON and only the fields which differ are stored.
+func Record(c *gin.Context, entity string, entityID string, action string, before any, after any) ferror.FError {
+	return RecordWith(c, database.Default(), entity, entityID, action, before, after)
+}
+
+// RecordWith records a change of an entity on q, pass the *database.Tx of the change to write the entry only if the change is committed
+func RecordWith(c *gin.Context, q database.Querier, entity string, entityID string, action string, before any, after any) ferror.FError {
+	changes, ferr := Diff(before, after)
+	if ferr != nil {
+		return ferr
+	}
+
+	userID := ""
+	user, ferr := users.GetUserFromContext(c)
+	if ferr == nil {
+		userID = user.ID
+	}
+
+	_, ferr = database.ExecWith(c, q, "INSERT INTO "+TableName+" (entity, entity_id, action, changes, user_id, request_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		entity, entityID, action, changes, userID, logger.GetRequestID(c), time.Now().UTC())
+	if ferr != nil {
+		ferr.SetInternal(fmt.Sprintf("error during recording %s of %s %s", action, entity, entityID))
+		return ferr
+	}
+	return nil
+}
+
+// History returns the entries of an entity, the newest first
+func History(ctx context.Context, entity string, entityID string, limit int) ([]Entry, ferror.FError) {
+	return database.SelectContext[Entry](ctx, "SELECT id, entity, entity_id, action, changes, user_id, request_id, created_at FROM "+TableName+
+		" WHERE entity = ? AND entity_id = ? ORDER BY created_at DESC, id DESC LIMIT ?", entity, entityID, limit)
+}
+
+// Diff returns the fields of before and after whose JSON values differ. A nil value (e.g. before on create) has no fields,
+// a value which is not marshalled to a JSON object is compared as a whole under the name "value".
+func Diff(before any, after any) (Changes, ferror.FError) {
+	beforeFields, ferr := jsonFields(before)
+	if ferr != nil {
+		return nil, ferr
+	}
+	afterFields, ferr := jsonFields(after)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	changes := Changes{}
+	names := slices.Sorted(maps.Keys(beforeFields))
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if !reflect.DeepEqual(beforeFields[name], afterFields[name]) {
+			changes[name] = Change{Before: beforeFields[name], After: afterFields[name]}
+		}
+	}
+	return changes, nil
+}
+
+// jsonFields marshals value to JSON and returns its fields
+func jsonFields(value any) (map[string]any, ferror.FError) {
+	if value == nil {
+		return map[string]any{}, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, newError(err, "marshal audited value")
+	}
+	var decoded any
+	err = json.Unmarshal(content, &decoded)
+	if err != nil {
+		return nil, newError(err, "unmarshal audited value")
+	}
+	switch decoded := decoded.(type) {
+	case nil:
+		return map[string]any{}, nil
+	case map[string]any:
+		return decoded, nil
+	default:
+		return map[string]any{"value": decoded}, nil
+	}
+}
+
+// Value implements driver.Valuer, the changes are stored as JSON
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	content, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(content), nil
+}
+
+// Scan implements sql.Scanner
+func (c *Changes) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c)
+	case string:
+		return json.Unmarshal([]byte(src), c)
+	default:
+		return fmt.Errorf("can not scan %T into audit changes", src)
+	}
+}
+
+// newError wraps an error of the audit package
+func newError(err error, internal string) ferror.FError {
+	ferr := ferror.FromError(err)
+	ferr.SetLayer("audit")
+	ferr.SetKind("audit")
+	ferr.SetInternal(internal)
+	return ferr
+}
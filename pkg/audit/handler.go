@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// InitAuditHandler registers the history endpoint. The history may contain personal data,
+// so router should be a group which checks the privileges of the user.
+func InitAuditHandler(router gin.IRoutes) {
+	router.GET("/api/audit/:entity/:id", historyHandler)
+}
+
+// historyHandler godoc
+//
+//	@Summary		Audit history
+//	@Description	Returns the recorded changes of an entity, the newest first
+//	@Tags			Audit
+//	@Produce		json
+//	@Param			entity	path		string	true	"Entity"
+//	@Param			id		path		string	true	"Entity ID"
+//	@Param			limit	query		int		false	"Maximum number of entries (default 100, max 1000)"
+//	@Success		200		{array}		Entry
+//	@Failure		400		{object}	map[string]any
+//	@Failure		500		{object}	map[string]any
+//	@Router			/api/audit/{entity}/{id} [get]
+func historyHandler(c *gin.Context) {
+	limit := defaultHistoryLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "invalid limit",
+			})
+			return
+		}
+		limit = min(parsed, maxHistoryLimit)
+	}
+
+	entries, ferr := History(c, c.Param("entity"), c.Param("id"), limit)
+	if ferr != nil {
+		logger.Log.Error(ferr.Error())
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "error during reading audit history",
+		})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, entries)
+}
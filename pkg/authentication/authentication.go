@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/fabiokaelin/fcommon/pkg/database"
 	"github.com/fabiokaelin/fcommon/pkg/logger"
 	"github.com/fabiokaelin/fcommon/pkg/notification"
 	"github.com/fabiokaelin/fcommon/pkg/users"
@@ -27,7 +27,9 @@ type (
 
 	UserExistFunc   func(string) bool
 	GetUserByIDFunc func(string) (users.Minimal, ferror.FError)
-	CreateUserFunc  func(users.Minimal) ferror.FError
+	// CreateUserFunc creates a user. If the user already exists it has to return the ferror of the database package unchanged,
+	// an existing user is only detected by its kind database.KindDuplicate.
+	CreateUserFunc func(users.Minimal) ferror.FError
 )
 
 var (
@@ -198,7 +200,7 @@ func checkUser(userData users.Minimal) (users.Minimal, error) {
 		return users.Minimal{}, errors.New("no email or name")
 	}
 	if ferr != nil {
-		if strings.Contains(ferr.Error(), "Duplicate entry") {
+		if database.IsDuplicate(ferr) {
 			logger.Log.Warn("user already exists")
 
 			time.Sleep(800 * time.Millisecond)
@@ -25,6 +25,10 @@ func InitBaseHandler(router *gin.Engine, ignored IgnoreChecks, defaultMessage st
 
 	router.GET("/internal/health/live", healthLiveHandler)
 	router.GET("/internal/health/ready", healthReadyHandler(ignored))
+
+	if !ignored.Database {
+		router.GET("/internal/database/schema", schemaHandler)
+	}
 }
 
 // versionHandler godoc
@@ -106,9 +110,9 @@ func healthReadyHandler(ignored IgnoreChecks) gin.HandlerFunc {
 		}
 
 		if !ignored.Database {
-			err := database.DBConnection.Ping()
-			if err != nil {
-				logger.Log.Error(err.Error())
+			status := database.Status()
+			if !status.Connected {
+				logger.Log.Error(status.LastError)
 				logger.Log.Error("database not ready")
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 					"error": "database not ready",
@@ -123,6 +127,39 @@ func healthReadyHandler(ignored IgnoreChecks) gin.HandlerFunc {
 	}
 }
 
+// schemaHandler godoc
+//
+//	@Summary		Database schema drift
+//	@Description	Compares the database against the expected schema and the migrations, "configured" is false if neither is set
+//	@Tags			Base
+//	@Produce		json
+//	@Success		200	{object}	map[string]any
+//	@Failure		500	{object}	map[string]any
+//	@Router			/internal/database/schema [get]
+func schemaHandler(c *gin.Context) {
+	if !database.SchemaCheckConfigured() {
+		// without an expected schema or migrations an empty diff would wrongly report that there is no drift
+		c.IndentedJSON(http.StatusOK, gin.H{
+			"configured": false,
+		})
+		return
+	}
+	diff, ferr := database.CheckSchema(c)
+	if ferr != nil {
+		logger.Log.Error(ferr.Message())
+		logger.Log.Error("schema check failed")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "schema check failed",
+		})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"configured": true,
+		"drift":      !diff.Empty(),
+		"diff":       diff,
+	})
+}
+
 // defaultHandler godoc
 //
 //	@Summary		defaultHandler
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fabiokaelin/ferror"
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	// CacheOptions configures how the result of a single cached query is stored
+	CacheOptions struct {
+		TTL  time.Duration // how long the result is used, 0 or negative bypasses the cache
+		Tags []string      // tags to invalidate the result with, e.g. the names of the tables the query reads
+	}
+
+	// queryCache is a size bounded LRU cache for query results. Concurrent misses of the same key are merged into a single query.
+	queryCache struct {
+		mutex      sync.Mutex
+		maxEntries int
+		entries    map[string]*list.Element
+		lru        *list.List                     // front is the most recently used entry
+		tags       map[string]map[string]struct{} // tag to keys
+		// generation is incremented by every invalidation, a query which started before is not stored because its result may be stale
+		generation uint64
+		group      singleflight.Group
+	}
+
+	// cacheEntry is a cached query result
+	cacheEntry struct {
+		key     string
+		value   any
+		expires time.Time
+		tags    []string
+	}
+)
+
+// EnableCache enables the query cache of the default client, see Client.EnableCache
+func EnableCache(maxEntries int) {
+	defaultClient.EnableCache(maxEntries)
+}
+
+// InvalidateCache removes all results with one of the tags from the cache of the default client
+func InvalidateCache(tags ...string) {
+	defaultClient.InvalidateCache(tags...)
+}
+
+// EnableCache enables the cache used by SelectCached and GetCached, which keeps at most maxEntries results.
+// It has to be called before the client is used. Without it the cached functions always query the database.
+func (c *Client) EnableCache(maxEntries int) {
+	c.cache = &queryCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		tags:       map[string]map[string]struct{}{},
+	}
+}
+
+// InvalidateCache removes all results with one of the tags from the cache, it should be called after the tagged data was changed
+func (c *Client) InvalidateCache(tags ...string) {
+	if c.cache != nil {
+		c.cache.invalidate(tags...)
+	}
+}
+
+// SelectCached is like Select, but the result is cached on the default client
+func SelectCached[T any](ctx context.Context, opts CacheOptions, query string, parameters ...any) ([]T, ferror.FError) {
+	return SelectCachedWith[T](ctx, defaultClient, opts, query, parameters...)
+}
+
+// GetCached is like Get, but the result is cached on the default client. KindNotFound errors are not cached.
+func GetCached[T any](ctx context.Context, opts CacheOptions, query string, parameters ...any) (T, ferror.FError) {
+	return GetCachedWith[T](ctx, defaultClient, opts, query, parameters...)
+}
+
+// SelectCachedWith is like SelectWith, but the result is cached by query and parameters for opts.TTL.
+// All callers share the cached slice, so it must not be modified.
+// Queries with a parameter which is not a plain value (e.g. a struct) bypass the cache.
+func SelectCachedWith[T any](ctx context.Context, c *Client, opts CacheOptions, query string, parameters ...any) ([]T, ferror.FError) {
+	value, ferr := cached(ctx, c, opts, query, cacheKey[[]T](query, parameters), func(ctx context.Context) (any, ferror.FError) {
+		return SelectWith[T](ctx, c, query, parameters...)
+	})
+	if ferr != nil {
+		return nil, ferr
+	}
+	return value.([]T), nil
+}
+
+// GetCachedWith is like GetWith, but the result is cached by query and parameters for opts.TTL.
+// Queries with a parameter which is not a plain value (e.g. a struct) bypass the cache.
+func GetCachedWith[T any](ctx context.Context, c *Client, opts CacheOptions, query string, parameters ...any) (T, ferror.FError) {
+	value, ferr := cached(ctx, c, opts, query, cacheKey[T](query, parameters), func(ctx context.Context) (any, ferror.FError) {
+		return GetWith[T](ctx, c, query, parameters...)
+	})
+	if ferr != nil {
+		var result T
+		return result, ferr
+	}
+	return value.(T), nil
+}
+
+// cacheKey builds the key of a query, the result type is part of it because the same query may be scanned into different types.
+// The parameters are converted like the driver does, so pointers and driver.Valuer are keyed by their value and not by their address.
+// It returns "" if a parameter can not be converted, such a query is not cached.
+func cacheKey[T any](query string, parameters []any) string {
+	values := make([]driver.Value, len(parameters))
+	for i, parameter := range parameters {
+		value, err := driver.DefaultParameterConverter.ConvertValue(parameter)
+		if err != nil {
+			return ""
+		}
+		values[i] = value
+	}
+	var result T
+	return fmt.Sprintf("%T\x00%s\x00%#v", result, query, values)
+}
+
+// cached returns the cached value of key or calls load and caches its result. Errors are never cached.
+// Concurrent misses share one load, which runs without the cancellation of the caller who started it (the query timeout still applies),
+// so a caller who goes away does not fail the others. Every caller only waits until its own ctx is done.
+func cached(ctx context.Context, c *Client, opts CacheOptions, query string, key string, load func(ctx context.Context) (any, ferror.FError)) (any, ferror.FError) {
+	cache := c.cache
+	if cache == nil || opts.TTL <= 0 || key == "" {
+		return load(ctx)
+	}
+	if value, ok := cache.get(key); ok {
+		return value, nil
+	}
+
+	ctx = baseContext(ctx)
+	result := cache.group.DoChan(key, func() (any, error) {
+		generation := cache.currentGeneration()
+		value, ferr := load(context.WithoutCancel(ctx))
+		if ferr != nil {
+			return nil, ferr
+		}
+		cache.set(key, value, opts, generation)
+		return value, nil
+	})
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return nil, r.Err.(ferror.FError)
+		}
+		return r.Val, nil
+	case <-ctx.Done():
+		return nil, queryError(ctx, ctx.Err(), query)
+	}
+}
+
+// get returns a value which is not expired and marks it as recently used
+func (q *queryCache) get(key string) (any, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	element, ok := q.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		q.remove(element)
+		return nil, false
+	}
+	q.lru.MoveToFront(element)
+	return entry.value, true
+}
+
+// currentGeneration returns the number of invalidations so far
+func (q *queryCache) currentGeneration() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.generation
+}
+
+// set stores a value unless the cache was invalidated since generation and evicts the least recently used entries above the limit
+func (q *queryCache) set(key string, value any, opts CacheOptions, generation uint64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if generation != q.generation {
+		return
+	}
+	if element, ok := q.entries[key]; ok {
+		q.remove(element)
+	}
+
+	entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(opts.TTL), tags: opts.Tags}
+	q.entries[key] = q.lru.PushFront(entry)
+	for _, tag := range opts.Tags {
+		if q.tags[tag] == nil {
+			q.tags[tag] = map[string]struct{}{}
+		}
+		q.tags[tag][key] = struct{}{}
+	}
+
+	for q.maxEntries > 0 && q.lru.Len() > q.maxEntries {
+		q.remove(q.lru.Back())
+	}
+}
+
+// invalidate removes all entries with one of the tags
+func (q *queryCache) invalidate(tags ...string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.generation++
+	for _, tag := range tags {
+		for key := range q.tags[tag] {
+			if element, ok := q.entries[key]; ok {
+				q.remove(element)
+			}
+		}
+		delete(q.tags, tag)
+	}
+}
+
+// remove deletes an entry from the list, the map and the tag index, the mutex has to be held
+func (q *queryCache) remove(element *list.Element) {
+	entry := q.lru.Remove(element).(*cacheEntry)
+	delete(q.entries, entry.key)
+	for _, tag := range entry.tags {
+		delete(q.tags[tag], entry.key)
+		if len(q.tags[tag]) == 0 {
+			delete(q.tags, tag)
+		}
+	}
+}
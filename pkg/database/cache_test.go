@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingHook counts the queries and holds each one in BeforeQuery until release is closed
+type blockingHook struct {
+	queries atomic.Int64
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHook() *blockingHook {
+	return &blockingHook{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (h *blockingHook) BeforeQuery(ctx context.Context, info *QueryInfo) context.Context {
+	h.queries.Add(1)
+	h.started <- struct{}{}
+	<-h.release
+	return ctx
+}
+
+func (h *blockingHook) AfterQuery(ctx context.Context, info *QueryInfo) {}
+
+// newCacheClient returns a test client with the cache enabled and a hook which counts the queries
+func newCacheClient(t *testing.T, maxEntries int) (*Client, *countingHook) {
+	t.Helper()
+	c := newTestClient(t)
+	c.EnableCache(maxEntries)
+	hook := &countingHook{}
+	c.AddQueryHook(hook)
+	return c, hook
+}
+
+// getName reads the name of an item through the cache
+func getName(t *testing.T, c *Client, opts CacheOptions, id any) string {
+	t.Helper()
+	name, ferr := GetCachedWith[string](context.Background(), c, opts, "SELECT name FROM items WHERE id = ?", id)
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	return name
+}
+
+func TestCacheHit(t *testing.T) {
+	c, hook := newCacheClient(t, 10)
+	opts := CacheOptions{TTL: time.Minute}
+
+	if name := getName(t, c, opts, 1); name != "one" {
+		t.Errorf("name = %q, want one", name)
+	}
+	if name := getName(t, c, opts, 1); name != "one" {
+		t.Errorf("cached name = %q, want one", name)
+	}
+	if got := hook.queries.Load(); got != 1 {
+		t.Errorf("%d queries for the same key, want 1", got)
+	}
+
+	getName(t, c, opts, 2)
+	names, ferr := SelectCachedWith[string](context.Background(), c, opts, "SELECT name FROM items WHERE id = ?", 1)
+	if ferr != nil || len(names) != 1 {
+		t.Fatalf("SelectCachedWith = %q, %v", names, ferr)
+	}
+	if got := hook.queries.Load(); got != 3 {
+		t.Errorf("%d queries, want 3: other parameters and result types are other keys", got)
+	}
+}
+
+func TestCacheBypass(t *testing.T) {
+	c, hook := newCacheClient(t, 10)
+	getName(t, c, CacheOptions{}, 1)
+	getName(t, c, CacheOptions{}, 1)
+	if got := hook.queries.Load(); got != 2 {
+		t.Errorf("%d queries without TTL, want 2", got)
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	c, hook := newCacheClient(t, 10)
+	opts := CacheOptions{TTL: 20 * time.Millisecond}
+	getName(t, c, opts, 1)
+	time.Sleep(30 * time.Millisecond)
+	getName(t, c, opts, 1)
+	if got := hook.queries.Load(); got != 2 {
+		t.Errorf("%d queries, want 2 after the TTL", got)
+	}
+}
+
+func TestCacheErrorsAreNotCached(t *testing.T) {
+	c, hook := newCacheClient(t, 10)
+	opts := CacheOptions{TTL: time.Minute}
+	for range 2 {
+		_, ferr := GetCachedWith[string](context.Background(), c, opts, "SELECT name FROM items WHERE id = ?", 42)
+		if !IsNotFound(ferr) {
+			t.Fatalf("GetCachedWith returned %v, want an error of kind %s", ferr, KindNotFound)
+		}
+	}
+	if got := hook.queries.Load(); got != 2 {
+		t.Errorf("%d queries, want 2 because errors are not cached", got)
+	}
+}
+
+func TestCacheKeyByValue(t *testing.T) {
+	c, hook := newCacheClient(t, 10)
+	opts := CacheOptions{TTL: time.Minute}
+	first, second := 3, 3
+	getName(t, c, opts, &first)
+	getName(t, c, opts, &second)
+	getName(t, c, opts, int64(3))
+	if got := hook.queries.Load(); got != 1 {
+		t.Errorf("%d queries for equal values behind different pointers, want 1", got)
+	}
+
+	first = 1
+	if name := getName(t, c, opts, &first); name != "one" {
+		t.Errorf("name = %q after the pointed to value changed, want one", name)
+	}
+
+	id := NewUUID()
+	if cacheKey[string]("q", []any{id}) != cacheKey[string]("q", []any{&id}) {
+		t.Error("a driver.Valuer and a pointer to it have different keys")
+	}
+	if cacheKey[string]("q", []any{1}) == cacheKey[string]("q", []any{"1"}) {
+		t.Error("1 and \"1\" have the same key")
+	}
+	if key := cacheKey[string]("q", []any{struct{ ID int }{1}}); key != "" {
+		t.Errorf("key of a struct parameter = %q, want none so the cache is bypassed", key)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, hook := newCacheClient(t, 2)
+	opts := CacheOptions{TTL: time.Minute}
+	getName(t, c, opts, 1)
+	getName(t, c, opts, 2)
+	getName(t, c, opts, 1) // 1 is now used more recently than 2
+	getName(t, c, opts, 3) // evicts 2
+	if got := hook.queries.Load(); got != 3 {
+		t.Fatalf("%d queries, want 3", got)
+	}
+
+	getName(t, c, opts, 1)
+	getName(t, c, opts, 3)
+	if got := hook.queries.Load(); got != 3 {
+		t.Errorf("%d queries, want 3 because 1 and 3 are cached", got)
+	}
+	getName(t, c, opts, 2)
+	if got := hook.queries.Load(); got != 4 {
+		t.Errorf("%d queries, want 4 because 2 was evicted", got)
+	}
+}
+
+func TestCacheInvalidateTags(t *testing.T) {
+	c, hook := newCacheClient(t, 10)
+	items := CacheOptions{TTL: time.Minute, Tags: []string{"items"}}
+	other := CacheOptions{TTL: time.Minute, Tags: []string{"other"}}
+	getName(t, c, items, 1)
+	getName(t, c, other, 2)
+
+	_, ferr := ExecWith(context.Background(), c, "UPDATE items SET name = 'uno' WHERE id = 1")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	c.InvalidateCache("items")
+
+	if name := getName(t, c, items, 1); name != "uno" {
+		t.Errorf("name = %q after the invalidation, want uno", name)
+	}
+	getName(t, c, other, 2)
+	// the two loads, the update and the reload of the invalidated result
+	if got := hook.queries.Load(); got != 4 {
+		t.Errorf("%d queries, want 4 because only the items tag was invalidated", got)
+	}
+}
+
+func TestCacheMergesConcurrentMisses(t *testing.T) {
+	c := newTestClient(t)
+	c.EnableCache(10)
+	hook := newBlockingHook()
+	c.AddQueryHook(hook)
+	opts := CacheOptions{TTL: time.Minute}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	names := make([]string, callers)
+	errs := make([]error, callers)
+	load := func(i int) {
+		defer wg.Done()
+		name, ferr := GetCachedWith[string](context.Background(), c, opts, "SELECT name FROM items WHERE id = ?", 2)
+		names[i] = name
+		if ferr != nil {
+			errs[i] = ferr
+		}
+	}
+
+	wg.Add(callers)
+	go load(0)
+	<-hook.started
+	for i := 1; i < callers; i++ {
+		go load(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(hook.release)
+	wg.Wait()
+
+	if got := hook.queries.Load(); got != 1 {
+		t.Errorf("%d queries for %d concurrent callers, want 1", got, callers)
+	}
+	for i := range callers {
+		if errs[i] != nil || names[i] != "two" {
+			t.Errorf("caller %d got %q, %v", i, names[i], errs[i])
+		}
+	}
+}
+
+func TestCacheCallerCancelDoesNotFailOthers(t *testing.T) {
+	c := newTestClient(t)
+	c.EnableCache(10)
+	hook := newBlockingHook()
+	c.AddQueryHook(hook)
+	opts := CacheOptions{TTL: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, ferr := GetCachedWith[string](ctx, c, opts, "SELECT name FROM items WHERE id = ?", 3)
+		if ferr != nil && !IsCancelled(ferr) {
+			t.Errorf("cancelled caller got %v, want an error of kind %s", ferr, KindCancelled)
+		}
+		firstErr <- ferr
+	}()
+	<-hook.started
+
+	second := make(chan string, 1)
+	go func() {
+		name, ferr := GetCachedWith[string](context.Background(), c, opts, "SELECT name FROM items WHERE id = ?", 3)
+		if ferr != nil {
+			t.Errorf("waiting caller: %s", ferr.Error())
+		}
+		second <- name
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// the caller who started the load goes away, it returns at once while the load goes on
+	cancel()
+	if ferr := <-firstErr; ferr == nil {
+		t.Error("cancelled caller got no error")
+	}
+	close(hook.release)
+	if name := <-second; name != "three" {
+		t.Errorf("waiting caller got %q, want three", name)
+	}
+	if got := hook.queries.Load(); got != 1 {
+		t.Errorf("%d queries, want 1", got)
+	}
+}
+
+func TestCacheDropsResultAfterInvalidation(t *testing.T) {
+	c := newTestClient(t)
+	c.EnableCache(10)
+	hook := newBlockingHook()
+	c.AddQueryHook(hook)
+	opts := CacheOptions{TTL: time.Minute, Tags: []string{"items"}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, ferr := GetCachedWith[string](context.Background(), c, opts, "SELECT name FROM items WHERE id = ?", 1)
+		if ferr != nil {
+			t.Errorf("load: %s", ferr.Error())
+		}
+	}()
+	<-hook.started
+	// the data changes while the load is running, its result may be stale
+	c.InvalidateCache("items")
+	close(hook.release)
+	<-done
+
+	getName(t, c, opts, 1)
+	if got := hook.queries.Load(); got != 2 {
+		t.Errorf("%d queries, want 2 because the result of the first load was not stored", got)
+	}
+}
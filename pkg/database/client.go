@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fabiokaelin/fcommon/pkg/migrations"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+)
+
+// Client is a connection to one database. Use NewClient to talk to a database other than the one configured in values.V,
+// the package level functions use the default client.
+type Client struct {
+	config         values.DatabaseValues
+	migrations     fs.FS
+	expectedSchema *Schema
+
+	// poolMutex guards current, closed and passwordHash. Operations hold the read lock only while registering on the pool, a reconnect takes the write lock to swap it.
+	poolMutex sync.RWMutex
+	current   *pool
+	closed    bool
+	// passwordHash is the checksum of the password file content the current pool was opened with
+	passwordHash [32]byte
+
+	// replicas contains all configured read replicas, it is only written by Connect
+	replicas []*replica
+	// nextReplica is used to distribute reads round robin over the healthy replicas
+	nextReplica atomic.Uint64
+
+	hooksMutex sync.RWMutex
+	hooks      []QueryHook
+
+	// cache is nil unless EnableCache was called
+	cache *queryCache
+
+	// statusMutex guards status, which is updated by reconnects and the health check
+	statusMutex sync.Mutex
+	status      HealthStatus
+
+	stop         chan struct{}
+	shutdownOnce sync.Once
+	shutdownErr  ferror.FError
+}
+
+// NewClient creates a client for config. It does not connect until Connect is called.
+func NewClient(config values.DatabaseValues) *Client {
+	return &Client{config: config, stop: make(chan struct{})}
+}
+
+// SetMigrations sets the migration files (e.g. an embed.FS) which Connect applies before the health check starts.
+// See the migrations package for the file naming.
+func (c *Client) SetMigrations(fsys fs.FS) {
+	c.migrations = fsys
+}
+
+// Connect connects to the database, applies the migrations and starts the health check and the watch of the password file.
+// The connection is retried according to the ConnectRetry policy of the config until ctx is done.
+func (c *Client) Connect(ctx context.Context) ferror.FError {
+	ferr := c.connectWithRetry(ctx)
+	if ferr != nil {
+		return ferr
+	}
+
+	c.openReplicas(ctx)
+
+	if c.migrations != nil {
+		ferr = migrations.Up(ctx, c.DB(), c.migrations)
+		if ferr != nil {
+			return ferr
+		}
+	}
+
+	c.startHealthCheck()
+	c.startPasswordWatch()
+	return nil
+}
+
+// DB returns the current connection pool or nil if there is none.
+// The pool may be replaced by a reconnect at any time, so it should not be stored.
+func (c *Client) DB() *sqlx.DB {
+	c.poolMutex.RLock()
+	defer c.poolMutex.RUnlock()
+	if c.current == nil {
+		return nil
+	}
+	return c.current.db
+}
+
+// Ping checks if the database is reachable
+func (c *Client) Ping(ctx context.Context) ferror.FError {
+	db, release := c.acquire()
+	defer release()
+	if db == nil {
+		return noConnectionError("ping")
+	}
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+	err := db.PingContext(ctx)
+	if err != nil {
+		return queryError(ctx, err, "ping")
+	}
+	return nil
+}
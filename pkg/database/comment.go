@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+)
+
+// routeKey is the context key of the route which issued a query
+type routeKey struct{}
+
+// WithRoute stores the route (or job name) in ctx which is added to the comment of the queries executed with it.
+// A *gin.Context does not need it, its route is used automatically.
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// annotate appends a comment in the sqlcommenter format (https://google.github.io/sqlcommenter/spec/) to query if QueryComments is enabled,
+// so the statement can be traced back in the processlist or the slow query log:
+//
+//	SELECT * FROM users WHERE id = ? /*request_id='4f1c...',route='%2Fapi%2Fusers%2F%3Aid',version='1.2.0'*/
+//
+// If the statement ends in a -- or # comment the tag goes on a new line. The values are taken from ctx, which is expected to be the result of baseContext.
+func (c *Client) annotate(ctx context.Context, query string) string {
+	if !c.config.QueryComments {
+		return query
+	}
+
+	// keys are sorted as required by the spec
+	pairs := make([]string, 0, 3)
+	if requestID := logger.GetRequestID(ctx); requestID != "" {
+		pairs = append(pairs, commentPair("request_id", requestID))
+	}
+	if route, _ := ctx.Value(routeKey{}).(string); route != "" {
+		pairs = append(pairs, commentPair("route", route))
+	}
+	if values.V.FVersion != "" {
+		pairs = append(pairs, commentPair("version", values.V.FVersion))
+	}
+	if len(pairs) == 0 {
+		return query
+	}
+	trimmed := strings.TrimSpace(query)
+	if endsInLineComment(trimmed) {
+		// the line comment would swallow the tag, so it goes on its own line
+		return trimmed + "\n/*" + strings.Join(pairs, ",") + "*/"
+	}
+	trimmed = strings.TrimRight(trimmed, ";")
+	if strings.HasSuffix(trimmed, "*/") {
+		// a statement which already has a comment is left alone
+		return query
+	}
+	// the comment has to be part of the statement, not follow the semicolon
+	return trimmed + " /*" + strings.Join(pairs, ",") + "*/"
+}
+
+// endsInLineComment reports if the last line of query ends inside a -- or # comment, quotes and block comments are skipped
+func endsInLineComment(query string) bool {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		case c == '#' || strings.HasPrefix(query[i:], "-- ") || strings.HasPrefix(query[i:], "--\t") || query[i:] == "--":
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return true
+			}
+			i += end
+		}
+	}
+	return false
+}
+
+// commentPair formats a key value pair, the value is URL encoded so it can not end the comment
+func commentPair(key string, value string) string {
+	return key + "='" + strings.ReplaceAll(url.QueryEscape(value), "+", "%20") + "'"
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabiokaelin/fcommon/pkg/values"
+)
+
+func TestAnnotate(t *testing.T) {
+	version := values.V.FVersion
+	values.V.FVersion = ""
+	t.Cleanup(func() { values.V.FVersion = version })
+
+	c := NewClient(values.DatabaseValues{QueryComments: true})
+	ctx := WithRoute(context.Background(), "/a")
+	const tag = "/*route='%2Fa'*/"
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"plain", "SELECT 1", "SELECT 1 " + tag},
+		{"semicolon", "SELECT 1;", "SELECT 1 " + tag},
+		{"existing comment", "SELECT 1 /*x*/", "SELECT 1 /*x*/"},
+		{"dash comment", "SELECT 1 -- trailing", "SELECT 1 -- trailing\n" + tag},
+		{"bare dashes", "SELECT 1 --", "SELECT 1 --\n" + tag},
+		{"hash comment", "SELECT 1 # trailing */", "SELECT 1 # trailing */\n" + tag},
+		{"comment on an earlier line", "SELECT 1 -- first\nFROM t", "SELECT 1 -- first\nFROM t " + tag},
+		{"dashes in a string", "SELECT '-- no comment'", "SELECT '-- no comment' " + tag},
+		{"hash in a block comment", "SELECT /* # */ 1", "SELECT /* # */ 1 " + tag},
+		{"dashes without space", "SELECT 1--2", "SELECT 1--2 " + tag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.annotate(ctx, tt.query); got != tt.want {
+				t.Errorf("annotate(%q)\n got: %q\nwant: %q", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	disabled := NewClient(values.DatabaseValues{})
+	if got := disabled.annotate(ctx, "SELECT 1"); got != "SELECT 1" {
+		t.Errorf("annotate without QueryComments = %q", got)
+	}
+}
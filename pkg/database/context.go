@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// baseContext returns the context to use for a query. For a *gin.Context the request context is used, because the gin context itself is never cancelled.
+// The route of the gin context is kept for the query comment.
+func baseContext(ctx context.Context) context.Context {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		if route := c.FullPath(); route != "" {
+			return WithRoute(c.Request.Context(), route)
+		}
+		return c.Request.Context()
+	}
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// queryTimeout returns the configured default timeout if it is shorter than the deadline already set on ctx
+func (c *Client) queryTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout := c.config.QueryTimeout
+	if timeout <= 0 {
+		return 0, false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return 0, false
+	}
+	return timeout, true
+}
+
+// queryContext applies the default query timeout to ctx. cancel has to be called as soon as the query is done.
+func (c *Client) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = baseContext(ctx)
+	timeout, ok := c.queryTimeout(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// rowsContext applies the default query timeout to ctx for results which are read after the call returns.
+// Cancelling earlier would close the rows, so the context is only released when it times out (or its parent is done).
+func (c *Client) rowsContext(ctx context.Context) context.Context {
+	ctx = baseContext(ctx)
+	timeout, ok := c.queryTimeout(ctx)
+	if !ok {
+		return ctx
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	// not called on purpose, the timer of the context releases it at the deadline
+	_ = cancel
+	return ctx
+}
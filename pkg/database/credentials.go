@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	"github.com/fabiokaelin/ferror"
+)
+
+// defaultPasswordInterval is the time between two checks of the password file if none is configured
+const defaultPasswordInterval = 30 * time.Second
+
+// connectionValues returns the config to open a pool with. If a password file is configured, the password is read from it
+// and its checksum is returned to detect a rotation. The password itself must never be logged.
+func (c *Client) connectionValues() (values.DatabaseValues, [32]byte, ferror.FError) {
+	dbValues := c.config
+	if dbValues.PasswordFile == "" {
+		return dbValues, [32]byte{}, nil
+	}
+	password, ferr := readPasswordFile(dbValues.PasswordFile)
+	if ferr != nil {
+		return dbValues, [32]byte{}, ferr
+	}
+	dbValues.DatabasePassword = password
+	return dbValues, sha256.Sum256([]byte(password)), nil
+}
+
+// readPasswordFile reads the password from path, a trailing line break is removed
+func readPasswordFile(path string) (string, ferror.FError) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		ferr := ferror.FromError(err)
+		ferr.SetLayer("db")
+		ferr.SetKind(KindConnection)
+		ferr.SetInternal("error during reading database password file " + path)
+		return "", ferr
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// startPasswordWatch starts a background routine which checks the password file regularly and rebuilds the pools if it changed
+func (c *Client) startPasswordWatch() {
+	if c.config.PasswordFile == "" {
+		return
+	}
+	interval := c.config.PasswordInterval
+	if interval <= 0 {
+		interval = defaultPasswordInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+			c.checkPasswordFile()
+		}
+	}()
+}
+
+// checkPasswordFile rebuilds the pools if the password in the file differs from the one the current pool was opened with.
+// Running queries finish on the old pools, which are closed afterwards. If the new password does not work yet, the old pool is kept
+// and the rotation is tried again at the next check. The replicas are compared on their own, the primary may already use the new
+// password after a reconnect of the health check.
+func (c *Client) checkPasswordFile() {
+	dbValues, passwordHash, ferr := c.connectionValues()
+	if ferr != nil {
+		logger.Log.Warn("database password file not readable: " + ferr.Message())
+		return
+	}
+
+	c.poolMutex.RLock()
+	changed := passwordHash != c.passwordHash
+	c.poolMutex.RUnlock()
+	if !changed && !c.replicasOutdated(passwordHash) {
+		return
+	}
+
+	if changed {
+		logger.Log.Info("database password file " + c.config.PasswordFile + " changed, rebuilding connection pool")
+		ferr = c.reconnect(context.Background())
+		if ferr != nil {
+			logger.Log.Warn("connecting with the rotated database password failed, keeping the current pool: " + ferr.Message())
+			// the failed reconnect marked the client as disconnected, but the current pool may still work with the old password
+			if c.Ping(context.Background()) == nil {
+				c.recordPing(nil)
+			}
+			return
+		}
+	}
+	c.reopenReplicas(dbValues, passwordHash)
+	logger.Log.Info("database credentials rotated")
+}
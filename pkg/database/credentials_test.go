@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fabiokaelin/fcommon/pkg/values"
+)
+
+func TestPasswordRotationAfterReconnect(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := connectTestClient(t, values.DatabaseValues{PasswordFile: passwordFile, ReplicaHosts: []string{"replica"}})
+	before := c.replicas[0].current
+
+	if err := os.WriteFile(passwordFile, []byte("new\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the health check reconnects the primary with the new password before the watch notices the rotation
+	if ferr := c.reconnect(context.Background()); ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	c.checkPasswordFile()
+
+	c.replicas[0].mutex.RLock()
+	after, hash := c.replicas[0].current, c.replicas[0].passwordHash
+	c.replicas[0].mutex.RUnlock()
+	if after == before {
+		t.Error("replica pool was not reopened")
+	}
+	c.poolMutex.RLock()
+	primaryHash := c.passwordHash
+	c.poolMutex.RUnlock()
+	if hash != primaryHash {
+		t.Error("replica was reopened with another password than the primary")
+	}
+	if c.replicasOutdated(primaryHash) {
+		t.Error("replicas are still outdated")
+	}
+}
@@ -3,149 +3,119 @@ package database
 import (
 	// "backend/config"
 
+	"context"
 	"database/sql"
-	"fmt"
-	"time"
+	"io/fs"
 
-	// database driver
+	// database driver, other drivers have to be registered by the service
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 
-	"github.com/fabiokaelin/fcommon/pkg/logger"
 	"github.com/fabiokaelin/fcommon/pkg/values"
 	"github.com/fabiokaelin/ferror"
 )
 
-var DBConnection *sqlx.DB
-var connectionString string
+// defaultClient is the client used by the package level functions, it is configured from values.V by InitDatabase
+var defaultClient = NewClient(values.DatabaseValues{})
 
-func InitDatabase() ferror.FError {
-	ferr := updateDBConnection()
-	if ferr != nil {
-		time.Sleep(10 * time.Second)
-		ferr = updateDBConnection()
-		if ferr != nil {
-			time.Sleep(10 * time.Second)
-			ferr = updateDBConnection()
-			if ferr != nil {
-				return ferr
-			}
-		}
-	}
+// Default returns the client used by the package level functions, e.g. to pass it to SelectWith
+func Default() *Client {
+	return defaultClient
+}
 
-	startDatabaseHealthCheck(5 * time.Minute)
-	return nil
+// SetMigrations sets the migration files (e.g. an embed.FS) which InitDatabase applies before the health check starts.
+// See the migrations package for the file naming.
+func SetMigrations(fsys fs.FS) {
+	defaultClient.SetMigrations(fsys)
 }
 
-// updateDBConnection initializes or updates the database connection
-func updateDBConnection() ferror.FError {
-	if connectionString == "" {
-		connectionString = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", values.V.DatabaseValues.DatabaseUser, values.V.DatabaseValues.DatabasePassword, values.V.DatabaseValues.DatabaseHost, values.V.DatabaseValues.DatabasePort, values.V.DatabaseValues.DatabaseName)
-	}
-	dbNew, err := sqlx.Open("mysql", connectionString)
-	if err != nil {
-		logger.Log.Error(err.Error())
-		DBConnection = nil
-		ferr := ferror.FromError(err)
-		ferr.SetLayer("db")
-		ferr.SetKind("db connection")
-		ferr.SetInternal("error during opening db connection")
-		return ferr
-	}
-	if dbNew == nil {
-		DBConnection = nil
-		ferr := ferror.New("new db connection is nil")
-		ferr.SetLayer("db")
-		ferr.SetKind("db connection")
-		ferr.SetInternal("error during opening db connection")
-		return ferr
-	}
-	// test if connection is working
-	err = dbNew.Ping()
-	if err != nil {
-		fmt.Println(err)
-		DBConnection = nil
-		ferr := ferror.New("ping to db failed")
-		ferr.SetLayer("db")
-		ferr.SetKind("db connection")
-		return ferr
-	}
-	if DBConnection != nil {
-		DBConnection.Close()
-		DBConnection = nil
-	}
-	DBConnection = dbNew
-	DBConnection.SetMaxOpenConns(100)
-	DBConnection.SetMaxIdleConns(30)
-	maxLifeTime := time.Minute * 30
-	DBConnection.SetConnMaxLifetime(maxLifeTime)
-	return nil
+// InitDatabase connects to the database configured in values.V, applies the migrations and starts the health check
+func InitDatabase() ferror.FError {
+	return InitDatabaseContext(context.Background())
 }
 
-// startDatabaseHealthCheck startet eine Hintergrundroutine für regelmässige Pings
-func startDatabaseHealthCheck(interval time.Duration) {
-	go func() {
-		for {
-			time.Sleep(interval)
-			if DBConnection == nil {
-				logger.Log.Warn("DBConnection is nil, trying to reconnect...")
-				_ = updateDBConnection()
-				continue
-			}
-
-			err := DBConnection.Ping()
-			if err != nil {
-				logger.Log.Warn("Ping failed, reconnecting... Error: " + err.Error())
-				_ = updateDBConnection()
-			}
-		}
-	}()
+// InitDatabaseContext is like InitDatabase, but stops retrying the connection when ctx is done
+func InitDatabaseContext(ctx context.Context) ferror.FError {
+	defaultClient.config = values.V.DatabaseValues
+	return defaultClient.Connect(ctx)
+}
+
+// DB returns the current connection pool of the default client or nil if there is none.
+// The pool may be replaced by a reconnect at any time, so it should not be stored.
+func DB() *sqlx.DB {
+	return defaultClient.DB()
 }
 
 // RunSQL executes a query
 func RunSQL(query string, parameters ...any) (*sql.Rows, ferror.FError) {
-	if DBConnection != nil {
-		// err := DBConnection.Ping()
-		// if err != nil {
-		// 	logger.Log.Warn("DB Connection lost, reconnecting...")
-		// 	ferr := updateDBConnection()
-		// 	if ferr != nil {
-		// 		return &sql.Rows{}, ferr
-		// 	}
-		// }
-		rows, err := DBConnection.Query(query, parameters...)
-		if err != nil {
-			ferr := ferror.FromError(err)
-			ferr.SetLayer("db")
-			ferr.SetKind("db execution")
-			ferr.SetInternal("error during executing " + query)
-			return &sql.Rows{}, ferr
-		}
-		return rows, nil
-	}
-	ferr := ferror.New("no db connection")
-	ferr.SetLayer("db")
-	ferr.SetKind("db execution")
-	return &sql.Rows{}, ferr
+	return defaultClient.RunSQLContext(context.Background(), query, parameters...)
+}
+
+// RunSQLContext executes a query bound to ctx. A *gin.Context can be passed directly, its request context is used.
+// The default query timeout also covers reading the returned rows.
+func RunSQLContext(ctx context.Context, query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return defaultClient.RunSQLContext(ctx, query, parameters...)
 }
 
 // RunSQLRow executes a query and returns a row
 func RunSQLRow(query string, parameters ...any) (*sql.Row, ferror.FError) {
-	if DBConnection != nil {
-		err := DBConnection.Ping()
-		if err != nil {
-			logger.Log.Warn("DB Connection lost, reconnecting...")
-			ferr := updateDBConnection()
-			if ferr != nil {
-				return &sql.Row{}, ferr
-			}
-		}
-		rows := DBConnection.QueryRow(query, parameters...)
-		return rows, nil
+	return defaultClient.RunSQLRowContext(context.Background(), query, parameters...)
+}
+
+// RunSQLRowContext executes a query bound to ctx and returns a row
+func RunSQLRowContext(ctx context.Context, query string, parameters ...any) (*sql.Row, ferror.FError) {
+	return defaultClient.RunSQLRowContext(ctx, query, parameters...)
+}
+
+// RunSQL executes a query
+func (c *Client) RunSQL(query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return c.RunSQLContext(context.Background(), query, parameters...)
+}
+
+// RunSQLContext executes a query bound to ctx
+func (c *Client) RunSQLContext(ctx context.Context, query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return runSQL(ctx, c, query, parameters...)
+}
+
+// RunSQLRow executes a query and returns a row
+func (c *Client) RunSQLRow(query string, parameters ...any) (*sql.Row, ferror.FError) {
+	return c.RunSQLRowContext(context.Background(), query, parameters...)
+}
+
+// RunSQLRowContext executes a query bound to ctx and returns a row
+func (c *Client) RunSQLRowContext(ctx context.Context, query string, parameters ...any) (*sql.Row, ferror.FError) {
+	return runSQLRow(ctx, c, query, parameters...)
+}
+
+// runSQL executes a query on q
+func runSQL(ctx context.Context, q Querier, query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	// rows which are still read after the release keep their connection, even if the pool gets closed in between
+	s, release := q.session()
+	defer release()
+	if s.db == nil {
+		return &sql.Rows{}, noConnectionError(query)
+	}
+	ctx, done := s.client.observeQuery(s.client.rowsContext(ctx), query, parameters)
+	rows, err := s.db.QueryContext(ctx, s.statement(ctx, query), parameters...)
+	done(-1, err)
+	if err != nil {
+		return &sql.Rows{}, queryError(ctx, err, query)
+	}
+	return rows, nil
+}
+
+// runSQLRow executes a query on q and returns a row
+func runSQLRow(ctx context.Context, q Querier, query string, parameters ...any) (*sql.Row, ferror.FError) {
+	s, release := q.session()
+	defer release()
+	if s.db == nil {
+		return &sql.Row{}, noConnectionError(query)
+	}
+	ctx, done := s.client.observeQuery(s.client.rowsContext(ctx), query, parameters)
+	row := s.db.QueryRowContext(ctx, s.statement(ctx, query), parameters...)
+	done(-1, row.Err())
+	if row.Err() != nil {
+		return row, queryError(ctx, row.Err(), query)
 	}
-	ferr := ferror.New("no db connection")
-	ferr.SetLayer("db")
-	ferr.SetKind("db execution")
-	ferr.SetInternal("error during executing " + query)
-	return &sql.Row{}, ferr
+	return row, nil
 }
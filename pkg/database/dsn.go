@@ -0,0 +1,199 @@
+package database
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	"github.com/fabiokaelin/ferror"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// DriverMySQL is the default driver, it is registered by this package
+	DriverMySQL = "mysql"
+	// DriverPostgres is the driver name of github.com/lib/pq, github.com/jackc/pgx/v5/stdlib registers "pgx"
+	DriverPostgres = "postgres"
+	// DriverSQLite is the driver name of modernc.org/sqlite, github.com/mattn/go-sqlite3 registers "sqlite3"
+	DriverSQLite = "sqlite"
+)
+
+func init() {
+	// sqlx does not know the driver name of modernc.org/sqlite
+	sqlx.BindDriver(DriverSQLite, sqlx.QUESTION)
+}
+
+// configuredDriver returns the configured driver name or mysql if none is set
+func configuredDriver(dbValues values.DatabaseValues) string {
+	if dbValues.Driver == "" {
+		return DriverMySQL
+	}
+	return dbValues.Driver
+}
+
+// buildDSN builds the connection string for the configured driver
+func buildDSN(dbValues values.DatabaseValues) (string, ferror.FError) {
+	switch driverName := configuredDriver(dbValues); {
+	case sqlx.BindType(driverName) == sqlx.DOLLAR:
+		return postgresDSN(dbValues), nil
+	case driverName == DriverSQLite || driverName == "sqlite3":
+		return sqliteDSN(dbValues), nil
+	default:
+		return mysqlDSN(dbValues)
+	}
+}
+
+// mysqlDSN builds a connection string for github.com/go-sql-driver/mysql. mysql.Config escapes the credentials, so they may contain any character.
+func mysqlDSN(dbValues values.DatabaseValues) (string, ferror.FError) {
+	cfg := mysql.NewConfig()
+	cfg.User = dbValues.DatabaseUser
+	cfg.Passwd = dbValues.DatabasePassword
+	cfg.DBName = dbValues.DatabaseName
+	cfg.ParseTime = true
+	if dbValues.Socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = dbValues.Socket
+	} else {
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(dbValues.DatabaseHost, dbValues.DatabasePort)
+	}
+
+	if dbValues.Charset != "" {
+		cfg.Params = map[string]string{"charset": dbValues.Charset}
+	}
+	if dbValues.Collation != "" {
+		cfg.Collation = dbValues.Collation
+	}
+	if dbValues.TimeZone != "" {
+		loc, err := time.LoadLocation(dbValues.TimeZone)
+		if err != nil {
+			return "", dsnError(err, "unknown time zone "+dbValues.TimeZone)
+		}
+		cfg.Loc = loc
+	}
+	cfg.Timeout = dbValues.DialTimeout
+	cfg.ReadTimeout = dbValues.ReadTimeout
+	cfg.WriteTimeout = dbValues.WriteTimeout
+
+	tlsConfig, ferr := mysqlTLSConfig(dbValues)
+	if ferr != nil {
+		return "", ferr
+	}
+	cfg.TLSConfig = tlsConfig
+	cfg.AllowFallbackToPlaintext = dbValues.TLS == "preferred"
+	return cfg.FormatDSN(), nil
+}
+
+// mysqlTLSConfig returns the value of the tls parameter. If a CA bundle or a client certificate is configured,
+// a custom tls.Config is registered at the driver and its name is returned.
+func mysqlTLSConfig(dbValues values.DatabaseValues) (string, ferror.FError) {
+	if dbValues.TLSCAFile == "" && dbValues.TLSCertFile == "" {
+		return dbValues.TLS, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: dbValues.TLSServerName,
+		// only for testing, the server certificate is not verified at all
+		InsecureSkipVerify: dbValues.TLS == "skip-verify",
+	}
+	if dbValues.TLSCAFile != "" {
+		pem, err := os.ReadFile(dbValues.TLSCAFile)
+		if err != nil {
+			return "", dsnError(err, "error during reading CA file "+dbValues.TLSCAFile)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return "", dsnError(nil, "no certificate found in CA file "+dbValues.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if dbValues.TLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(dbValues.TLSCertFile, dbValues.TLSKeyFile)
+		if err != nil {
+			return "", dsnError(err, "error during loading client certificate "+dbValues.TLSCertFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	// the name depends on the files, so clients with different certificates do not overwrite each other.
+	// The files are read again on every reconnect, which picks up rotated certificates.
+	hash := sha256.Sum256([]byte(dbValues.TLSCAFile + "\x00" + dbValues.TLSCertFile + "\x00" + dbValues.TLSKeyFile + "\x00" + dbValues.TLSServerName + "\x00" + dbValues.TLS))
+	name := "fcommon-" + hex.EncodeToString(hash[:8])
+	err := mysql.RegisterTLSConfig(name, tlsConfig)
+	if err != nil {
+		return "", dsnError(err, "error during registering tls config")
+	}
+	return name, nil
+}
+
+// dsnError wraps an invalid connection option, err may be nil
+func dsnError(err error, internal string) ferror.FError {
+	var ferr ferror.FError
+	if err != nil {
+		ferr = ferror.FromError(err)
+	} else {
+		ferr = ferror.New(internal)
+	}
+	ferr.SetLayer("db")
+	ferr.SetKind(KindConnection)
+	ferr.SetInternal(internal)
+	return ferr
+}
+
+// postgresDSN builds a connection url which is understood by lib/pq and pgx
+func postgresDSN(dbValues values.DatabaseValues) string {
+	host := dbValues.DatabaseHost
+	if dbValues.DatabasePort != "" {
+		host = net.JoinHostPort(host, dbValues.DatabasePort)
+	}
+	query := url.Values{}
+	query.Set("sslmode", postgresSSLMode(dbValues))
+	if dbValues.TLSCAFile != "" {
+		query.Set("sslrootcert", dbValues.TLSCAFile)
+	}
+	if dbValues.TLSCertFile != "" {
+		query.Set("sslcert", dbValues.TLSCertFile)
+		query.Set("sslkey", dbValues.TLSKeyFile)
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dbValues.DatabaseUser, dbValues.DatabasePassword),
+		Host:     host,
+		Path:     "/" + dbValues.DatabaseName,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+// postgresSSLMode maps the TLS option onto the sslmode parameter. It is always set, because lib/pq requires TLS if it is missing.
+func postgresSSLMode(dbValues values.DatabaseValues) string {
+	switch dbValues.TLS {
+	case "true":
+		return "verify-full"
+	case "skip-verify":
+		return "require"
+	case "preferred":
+		return "prefer"
+	case "", "false":
+		if dbValues.TLSCAFile != "" || dbValues.TLSCertFile != "" {
+			return "verify-full"
+		}
+		return "disable"
+	default:
+		// a postgres mode like "verify-ca" is passed through
+		return dbValues.TLS
+	}
+}
+
+// sqliteDSN builds a connection string for a sqlite file, DatabaseName is used as path ("file::memory:?cache=shared" for an in-memory database shared by the pool)
+func sqliteDSN(dbValues values.DatabaseValues) string {
+	return dbValues.DatabaseName
+}
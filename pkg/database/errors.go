@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/fabiokaelin/ferror"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// KindExecution is the error kind for a failed query
+	KindExecution = "db execution"
+	// KindTimeout is the error kind for a query which ran into its deadline
+	KindTimeout = "db timeout"
+	// KindCancelled is the error kind for a query whose context was cancelled (e.g. the client went away)
+	KindCancelled = "db cancelled"
+	// KindDeadlock is the error kind for a transaction which was chosen as deadlock victim
+	KindDeadlock = "db deadlock"
+	// KindLockTimeout is the error kind for a query which waited too long for a row lock
+	KindLockTimeout = "db lock timeout"
+	// KindNotFound is the error kind for a query which was expected to return a row but returned none
+	KindNotFound = "db not found"
+	// KindDuplicate is the error kind for an insert or update which violates a unique or primary key
+	KindDuplicate = "db duplicate"
+	// KindForeignKey is the error kind for a change which violates a foreign key constraint
+	KindForeignKey = "db foreign key"
+	// KindConnectionLost is the error kind for a query whose connection to the server broke
+	KindConnectionLost = "db connection lost"
+	// KindConflict is the error kind for an update which was rejected because the row was changed since it was read, see VersionedUpdate
+	KindConflict = "db conflict"
+	// KindConnection is the error kind for a connection which could not be opened, e.g. a wrong password or an unreachable server
+	KindConnection = "db connection"
+	// KindShutdown is the error kind for an operation on a client which was shut down and for errors during the shutdown
+	KindShutdown = "db shutdown"
+	// KindInvalidUUID is the error kind for a value which could not be parsed as UUID, see ParseUUID
+	KindInvalidUUID = "db invalid uuid"
+)
+
+// user messages of the error kinds which can be shown to a client, the message of the driver may contain data and the schema
+const (
+	notFoundMessage  = "not found"
+	duplicateMessage = "the entry already exists"
+	conflictMessage  = "the entry was changed in the meantime, reload it and try again"
+)
+
+// mysql error numbers, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	errDuplicateEntry     = 1062
+	errLockWaitTimeout    = 1205
+	errDeadlock           = 1213
+	errRowIsReferenced    = 1451
+	errNoReferencedRow    = 1452
+	errServerGone         = 2006
+	errServerLost         = 2013
+	errDuplicateEntryWith = 1586 // duplicate entry with key name, e.g. on ALTER TABLE
+)
+
+// kindByNumber maps mysql error numbers to error kinds
+var kindByNumber = map[uint16]string{
+	errDuplicateEntry:     KindDuplicate,
+	errDuplicateEntryWith: KindDuplicate,
+	errRowIsReferenced:    KindForeignKey,
+	errNoReferencedRow:    KindForeignKey,
+	errDeadlock:           KindDeadlock,
+	errLockWaitTimeout:    KindLockTimeout,
+	errServerGone:         KindConnectionLost,
+	errServerLost:         KindConnectionLost,
+}
+
+// queryError converts an error of a query into a ferror and sets the kind depending on why the query failed
+func queryError(ctx context.Context, err error, query string) ferror.FError {
+	ferr := ferror.FromError(err)
+	ferr.SetLayer("db")
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		ferr.SetKind(KindTimeout)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		ferr.SetKind(KindCancelled)
+	case kindByNumber[mysqlErrorNumber(err)] != "":
+		ferr.SetKind(kindByNumber[mysqlErrorNumber(err)])
+	case errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn):
+		// the driver reports a broken connection without a server error number
+		ferr.SetKind(KindConnectionLost)
+	default:
+		ferr.SetKind(KindExecution)
+	}
+	if ferr.Kind() == KindDuplicate {
+		// without it the user message falls back to the driver message, which contains the duplicate value and the key name
+		ferr.SetUserMsg(duplicateMessage)
+	}
+	ferr.SetInternal("error during executing " + query)
+	return ferr
+}
+
+// noConnectionError returns the error for a query which was executed without an open connection
+func noConnectionError(query string) ferror.FError {
+	ferr := ferror.New("no db connection")
+	ferr.SetLayer("db")
+	ferr.SetKind(KindExecution)
+	ferr.SetInternal("error during executing " + query)
+	return ferr
+}
+
+// mysqlErrorNumber returns the error number of a mysql server error or 0 for every other error
+func mysqlErrorNumber(err error) uint16 {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number
+	}
+	return 0
+}
+
+// IsNotFound reports if ferr is an error of kind KindNotFound
+func IsNotFound(ferr ferror.FError) bool {
+	return hasKind(ferr, KindNotFound)
+}
+
+// IsDuplicate reports if ferr was caused by a duplicate unique or primary key (mysql 1062)
+func IsDuplicate(ferr ferror.FError) bool {
+	return hasKind(ferr, KindDuplicate)
+}
+
+// IsForeignKeyViolation reports if ferr was caused by a foreign key constraint (mysql 1451, 1452)
+func IsForeignKeyViolation(ferr ferror.FError) bool {
+	return hasKind(ferr, KindForeignKey)
+}
+
+// IsDeadlock reports if ferr was caused by a deadlock (mysql 1213)
+func IsDeadlock(ferr ferror.FError) bool {
+	return hasKind(ferr, KindDeadlock)
+}
+
+// IsLockTimeout reports if ferr was caused by a lock wait timeout (mysql 1205)
+func IsLockTimeout(ferr ferror.FError) bool {
+	return hasKind(ferr, KindLockTimeout)
+}
+
+// IsConnectionLost reports if ferr was caused by a broken connection (mysql 2006, 2013)
+func IsConnectionLost(ferr ferror.FError) bool {
+	return hasKind(ferr, KindConnectionLost)
+}
+
+// IsTimeout reports if ferr was caused by a query which ran into its deadline
+func IsTimeout(ferr ferror.FError) bool {
+	return hasKind(ferr, KindTimeout)
+}
+
+// IsCancelled reports if ferr was caused by a cancelled context
+func IsCancelled(ferr ferror.FError) bool {
+	return hasKind(ferr, KindCancelled)
+}
+
+// IsConflict reports if an optimistic update failed because the row was changed in the meantime
+func IsConflict(ferr ferror.FError) bool {
+	return hasKind(ferr, KindConflict)
+}
+
+// IsConnectionError reports if ferr was caused by a connection which could not be opened
+func IsConnectionError(ferr ferror.FError) bool {
+	return hasKind(ferr, KindConnection)
+}
+
+// IsShutdown reports if ferr was returned because the client is shut down or by the shutdown itself
+func IsShutdown(ferr ferror.FError) bool {
+	return hasKind(ferr, KindShutdown)
+}
+
+// IsInvalidUUID reports if ferr was caused by a value which is not a valid UUID
+func IsInvalidUUID(ferr ferror.FError) bool {
+	return hasKind(ferr, KindInvalidUUID)
+}
+
+// hasKind reports if ferr is not nil and of the given kind
+func hasKind(ferr ferror.FError, kind string) bool {
+	return ferr != nil && ferr.Kind() == kind
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/fabiokaelin/ferror"
+)
+
+// ExecResult is the result of a statement which does not return rows (INSERT, UPDATE, DELETE)
+type ExecResult struct {
+	RowsAffected int64 // number of changed rows
+	LastInsertID int64 // id generated by an auto increment column, 0 if the driver does not support it (e.g. postgres)
+}
+
+// Exec executes a statement which does not return rows
+func Exec(query string, parameters ...any) (ExecResult, ferror.FError) {
+	return exec(context.Background(), defaultClient, query, parameters...)
+}
+
+// ExecContext executes a statement bound to ctx which does not return rows
+func ExecContext(ctx context.Context, query string, parameters ...any) (ExecResult, ferror.FError) {
+	return exec(ctx, defaultClient, query, parameters...)
+}
+
+// NamedExec executes a statement with named parameters (e.g. :name) which are taken from the `db` tags of a struct or the keys of a map.
+// If arg is a slice, a multi row insert is built for the VALUES part of the query.
+func NamedExec(query string, arg any) (ExecResult, ferror.FError) {
+	return namedExec(context.Background(), defaultClient, query, arg)
+}
+
+// NamedExecContext executes a statement with named parameters bound to ctx
+func NamedExecContext(ctx context.Context, query string, arg any) (ExecResult, ferror.FError) {
+	return namedExec(ctx, defaultClient, query, arg)
+}
+
+// RunNamedSQL executes a query with named parameters (e.g. :name) which are taken from the `db` tags of a struct or the keys of a map
+func RunNamedSQL(query string, arg any) (*sql.Rows, ferror.FError) {
+	return runNamedSQL(context.Background(), defaultClient, query, arg)
+}
+
+// RunNamedSQLContext executes a query with named parameters bound to ctx
+func RunNamedSQLContext(ctx context.Context, query string, arg any) (*sql.Rows, ferror.FError) {
+	return runNamedSQL(ctx, defaultClient, query, arg)
+}
+
+// Exec executes a statement which does not return rows
+func (c *Client) Exec(query string, parameters ...any) (ExecResult, ferror.FError) {
+	return exec(context.Background(), c, query, parameters...)
+}
+
+// ExecContext executes a statement bound to ctx which does not return rows
+func (c *Client) ExecContext(ctx context.Context, query string, parameters ...any) (ExecResult, ferror.FError) {
+	return exec(ctx, c, query, parameters...)
+}
+
+// NamedExec executes a statement with named parameters
+func (c *Client) NamedExec(query string, arg any) (ExecResult, ferror.FError) {
+	return namedExec(context.Background(), c, query, arg)
+}
+
+// NamedExecContext executes a statement with named parameters bound to ctx
+func (c *Client) NamedExecContext(ctx context.Context, query string, arg any) (ExecResult, ferror.FError) {
+	return namedExec(ctx, c, query, arg)
+}
+
+// RunNamedSQL executes a query with named parameters
+func (c *Client) RunNamedSQL(query string, arg any) (*sql.Rows, ferror.FError) {
+	return runNamedSQL(context.Background(), c, query, arg)
+}
+
+// RunNamedSQLContext executes a query with named parameters bound to ctx
+func (c *Client) RunNamedSQLContext(ctx context.Context, query string, arg any) (*sql.Rows, ferror.FError) {
+	return runNamedSQL(ctx, c, query, arg)
+}
+
+// Exec executes a statement inside the transaction which does not return rows
+func (tx *Tx) Exec(query string, parameters ...any) (ExecResult, ferror.FError) {
+	return exec(tx.ctx, tx, query, parameters...)
+}
+
+// NamedExec executes a statement with named parameters inside the transaction
+func (tx *Tx) NamedExec(query string, arg any) (ExecResult, ferror.FError) {
+	return namedExec(tx.ctx, tx, query, arg)
+}
+
+// RunNamedSQL executes a query with named parameters inside the transaction
+func (tx *Tx) RunNamedSQL(query string, arg any) (*sql.Rows, ferror.FError) {
+	return runNamedSQL(tx.ctx, tx, query, arg)
+}
+
+// ExecWith executes a statement bound to ctx on q (a *Client or a *Tx) which does not return rows.
+// If q is Client.Replica the statement is executed on the primary.
+func ExecWith(ctx context.Context, q Querier, query string, parameters ...any) (ExecResult, ferror.FError) {
+	return exec(ctx, q, query, parameters...)
+}
+
+// exec executes a statement on q, or on the primary if q are the replicas
+func exec(ctx context.Context, q Querier, query string, parameters ...any) (ExecResult, ferror.FError) {
+	s, release := primary(q).session()
+	defer release()
+	if s.db == nil {
+		return ExecResult{}, noConnectionError(query)
+	}
+	return s.exec(ctx, query, s.db.Rebind(query), parameters)
+}
+
+// exec executes an already rebound statement. query is the statement as passed by the caller and is used for logging.
+func (s session) exec(ctx context.Context, query string, bound string, parameters []any) (ExecResult, ferror.FError) {
+	ctx, cancel := s.client.queryContext(ctx)
+	defer cancel()
+
+	ctx, done := s.client.observeQuery(ctx, query, parameters)
+	result, err := s.db.ExecContext(ctx, s.client.annotate(ctx, bound), parameters...)
+	if err != nil {
+		done(0, err)
+		return ExecResult{}, queryError(ctx, err, query)
+	}
+
+	execResult := ExecResult{}
+	// not every driver supports both values, a missing value is reported as 0
+	execResult.RowsAffected, _ = result.RowsAffected()
+	execResult.LastInsertID, _ = result.LastInsertId()
+	done(execResult.RowsAffected, nil)
+	return execResult, nil
+}
+
+// namedExec binds the named parameters of query and executes it on q, or on the primary if q are the replicas
+func namedExec(ctx context.Context, q Querier, query string, arg any) (ExecResult, ferror.FError) {
+	s, release := primary(q).session()
+	defer release()
+	if s.db == nil {
+		return ExecResult{}, noConnectionError(query)
+	}
+	bound, parameters, ferr := s.bindNamed(query, arg)
+	if ferr != nil {
+		return ExecResult{}, ferr
+	}
+	return s.exec(ctx, query, bound, parameters)
+}
+
+// runNamedSQL binds the named parameters of query and executes it on q
+func runNamedSQL(ctx context.Context, q Querier, query string, arg any) (*sql.Rows, ferror.FError) {
+	s, release := q.session()
+	defer release()
+	if s.db == nil {
+		return &sql.Rows{}, noConnectionError(query)
+	}
+	bound, parameters, ferr := s.bindNamed(query, arg)
+	if ferr != nil {
+		return &sql.Rows{}, ferr
+	}
+	ctx, done := s.client.observeQuery(s.client.rowsContext(ctx), query, parameters)
+	rows, err := s.db.QueryContext(ctx, s.client.annotate(ctx, bound), parameters...)
+	done(-1, err)
+	if err != nil {
+		return &sql.Rows{}, queryError(ctx, err, query)
+	}
+	return rows, nil
+}
+
+// bindNamed replaces the named parameters of query with the placeholders of the driver
+func (s session) bindNamed(query string, arg any) (string, []any, ferror.FError) {
+	bound, parameters, err := s.db.BindNamed(query, arg)
+	if err != nil {
+		ferr := ferror.FromError(err)
+		ferr.SetLayer("db")
+		ferr.SetKind(KindExecution)
+		ferr.SetInternal("error during binding named parameters of " + query)
+		return "", nil, ferr
+	}
+	return bound, parameters, nil
+}
+
+// maxPlaceholders is the maximum number of placeholders mysql and postgres accept in a single prepared statement
+const maxPlaceholders = 65535
+
+// maxPlaceholdersSQLite is the default of SQLITE_MAX_VARIABLE_NUMBER since sqlite 3.32
+const maxPlaceholdersSQLite = 32766
+
+// placeholderLimit returns the maximum number of placeholders of a single statement for the driver
+func placeholderLimit(driverName string) int {
+	if driverName == DriverSQLite || driverName == "sqlite3" {
+		return maxPlaceholdersSQLite
+	}
+	return maxPlaceholders
+}
+
+// BulkInsert builds multi row INSERT statements and splits them into chunks which stay below the placeholder limit of the driver
+type BulkInsert struct {
+	table     string
+	columns   []string
+	rows      [][]any
+	suffix    string
+	chunkSize int
+	ferr      ferror.FError
+}
+
+// NewBulkInsert creates a bulk insert into the given columns of table. Table and columns must be valid identifiers, see ValidIdentifier.
+func NewBulkInsert(table string, columns ...string) *BulkInsert {
+	b := &BulkInsert{table: table, columns: columns}
+	b.ferr = checkIdentifiers("bulk insert into "+table, append([]string{table}, columns...)...)
+	return b
+}
+
+// Add adds a row, the values have to be in the same order as the columns
+func (b *BulkInsert) Add(values ...any) *BulkInsert {
+	if len(values) != len(b.columns) && b.ferr == nil {
+		b.ferr = ferror.New(fmt.Sprintf("bulk insert into %s expects %d values per row, got %d", b.table, len(b.columns), len(values)))
+		b.ferr.SetLayer("db")
+		b.ferr.SetKind(KindExecution)
+	}
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// Suffix appends a clause to every statement, e.g. "ON DUPLICATE KEY UPDATE name = VALUES(name)"
+func (b *BulkInsert) Suffix(suffix string) *BulkInsert {
+	b.suffix = suffix
+	return b
+}
+
+// ChunkSize sets the maximum number of rows per statement. It is lowered automatically if a chunk would exceed the placeholder limit.
+func (b *BulkInsert) ChunkSize(rows int) *BulkInsert {
+	b.chunkSize = rows
+	return b
+}
+
+// Exec executes the insert on q. Every chunk is a separate statement, pass a *Tx to insert all rows or none.
+// The result contains the sum of the affected rows and the last insert id of the first chunk.
+func (b *BulkInsert) Exec(ctx context.Context, q Querier) (ExecResult, ferror.FError) {
+	if b.ferr != nil {
+		return ExecResult{}, b.ferr
+	}
+	if len(b.rows) == 0 || len(b.columns) == 0 {
+		return ExecResult{}, nil
+	}
+
+	s, release := primary(q).session()
+	release()
+	chunkSize := placeholderLimit(configuredDriver(s.client.config)) / len(b.columns)
+	if b.chunkSize > 0 {
+		chunkSize = min(chunkSize, b.chunkSize)
+	}
+
+	total := ExecResult{}
+	for start := 0; start < len(b.rows); start += chunkSize {
+		chunk := b.rows[start:min(start+chunkSize, len(b.rows))]
+		query, parameters := b.build(chunk)
+		result, ferr := exec(ctx, q, query, parameters...)
+		if ferr != nil {
+			ferr.SetInternal(fmt.Sprintf("bulk insert into %s failed at row %d", b.table, start))
+			return total, ferr
+		}
+		if start == 0 {
+			total.LastInsertID = result.LastInsertID
+		}
+		total.RowsAffected += result.RowsAffected
+	}
+	return total, nil
+}
+
+// build creates the statement and parameters for a chunk of rows
+func (b *BulkInsert) build(rows [][]any) (string, []any) {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(b.columns)), ", ") + ")"
+
+	query := strings.Builder{}
+	query.WriteString("INSERT INTO " + b.table + " (" + strings.Join(b.columns, ", ") + ") VALUES ")
+	parameters := make([]any, 0, len(rows)*len(b.columns))
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(placeholders)
+		parameters = append(parameters, row...)
+	}
+	if b.suffix != "" {
+		query.WriteString(" " + b.suffix)
+	}
+	return query.String(), parameters
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidIdentifier(t *testing.T) {
+	tests := map[string]bool{
+		"users":            true,
+		"_tmp1":            true,
+		"app.users":        true,
+		"":                 false,
+		"1users":           false,
+		"app.":             false,
+		"a.b.c":            false,
+		"users; DROP x":    false,
+		"`users`":          false,
+		"name = 1 OR 1=1":  false,
+		"users--":          false,
+		"users/*comment*/": false,
+	}
+	for name, want := range tests {
+		if got := ValidIdentifier(name); got != want {
+			t.Errorf("ValidIdentifier(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// countingHook counts the queries executed through a client
+type countingHook struct {
+	queries atomic.Int64
+}
+
+func (h *countingHook) BeforeQuery(ctx context.Context, info *QueryInfo) context.Context {
+	h.queries.Add(1)
+	return ctx
+}
+
+func (h *countingHook) AfterQuery(ctx context.Context, info *QueryInfo) {}
+
+func TestPlaceholderLimit(t *testing.T) {
+	tests := map[string]int{
+		DriverMySQL:    65535,
+		DriverPostgres: 65535,
+		DriverSQLite:   32766,
+		"sqlite3":      32766,
+	}
+	for driverName, want := range tests {
+		if got := placeholderLimit(driverName); got != want {
+			t.Errorf("placeholderLimit(%q) = %d, want %d", driverName, got, want)
+		}
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	c := newTestClient(t)
+	_, ferr := ExecWith(context.Background(), c, "CREATE TABLE numbers (a INTEGER, b INTEGER)")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	hook := &countingHook{}
+	c.AddQueryHook(hook)
+
+	insert := NewBulkInsert("numbers", "a", "b").ChunkSize(4)
+	for i := range 10 {
+		insert.Add(i, i*2)
+	}
+	result, ferr := insert.Exec(context.Background(), c)
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	if result.RowsAffected != 10 {
+		t.Errorf("RowsAffected = %d, want 10", result.RowsAffected)
+	}
+	if got := hook.queries.Load(); got != 3 {
+		t.Errorf("%d statements executed, want 3 chunks", got)
+	}
+	count, ferr := GetWith[int](context.Background(), c, "SELECT COUNT(*) FROM numbers WHERE b = a * 2")
+	if ferr != nil || count != 10 {
+		t.Errorf("%d rows inserted, want 10 (%v)", count, ferr)
+	}
+}
+
+func TestBulkInsertInvalidIdentifier(t *testing.T) {
+	c := newTestClient(t)
+	_, ferr := NewBulkInsert("items", "id", "name) VALUES (1, 'x'); DROP TABLE items; --").Add(4, "four").Exec(context.Background(), c)
+	if ferr == nil || ferr.Kind() != KindExecution {
+		t.Fatalf("Exec returned %v, want an error of kind %s", ferr, KindExecution)
+	}
+	count, ferr := GetWith[int](context.Background(), c, "SELECT COUNT(*) FROM items")
+	if ferr != nil || count != 3 {
+		t.Errorf("items has %d rows, want 3 (%v)", count, ferr)
+	}
+}
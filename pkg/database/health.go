@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/ferror"
+)
+
+// defaultHealthInterval is the time between two pings of the health check if none is configured
+const defaultHealthInterval = 5 * time.Minute
+
+type (
+	// HealthStatus is the state of a client as seen by the last reconnect or health check
+	HealthStatus struct {
+		Connected   bool            `json:"connected"`
+		LastPing    time.Time       `json:"lastPing"`    // time of the last successful ping
+		LastError   string          `json:"lastError"`   // error of the last failed ping or reconnect
+		LastErrorAt time.Time       `json:"lastErrorAt"` // time of the last failed ping or reconnect
+		Reconnects  int64           `json:"reconnects"`  // number of times the pool was replaced after the first connect
+		Pool        sql.DBStats     `json:"pool"`        // statistics of the current pool
+		Replicas    []ReplicaStatus `json:"replicas"`
+	}
+
+	// ReplicaStatus is the state of a read replica
+	ReplicaStatus struct {
+		Host    string      `json:"host"`
+		Healthy bool        `json:"healthy"`
+		Pool    sql.DBStats `json:"pool"`
+	}
+)
+
+// Status returns the health state of the default client
+func Status() HealthStatus {
+	return defaultClient.Status()
+}
+
+// Status returns the health state of the client. It does not query the database, so it is cheap enough for readiness probes.
+func (c *Client) Status() HealthStatus {
+	c.statusMutex.Lock()
+	status := c.status
+	c.statusMutex.Unlock()
+
+	if db := c.DB(); db != nil {
+		status.Pool = db.Stats()
+	}
+	status.Replicas = make([]ReplicaStatus, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		status.Replicas = append(status.Replicas, ReplicaStatus{Host: r.host, Healthy: r.healthy.Load(), Pool: r.stats()})
+	}
+	return status
+}
+
+// recordPing updates the status with the result of a ping or reconnect
+func (c *Client) recordPing(ferr ferror.FError) {
+	c.statusMutex.Lock()
+	defer c.statusMutex.Unlock()
+	if ferr != nil {
+		c.status.Connected = false
+		c.status.LastError = ferr.Message()
+		c.status.LastErrorAt = time.Now()
+		return
+	}
+	c.status.Connected = true
+	c.status.LastPing = time.Now()
+}
+
+// healthInterval returns the time until the next health check
+func (c *Client) healthInterval() time.Duration {
+	interval := c.config.HealthInterval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	if c.config.HealthJitter > 0 {
+		interval += time.Duration(float64(interval) * c.config.HealthJitter * (2*rand.Float64() - 1))
+	}
+	return interval
+}
+
+// startHealthCheck starts a background routine which pings the database regularly and reconnects if needed
+func (c *Client) startHealthCheck() {
+	go func() {
+		timer := time.NewTimer(c.healthInterval())
+		defer timer.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-timer.C:
+			}
+			c.checkHealth()
+			timer.Reset(c.healthInterval())
+		}
+	}()
+}
+
+// checkHealth pings the primary and all replicas and reconnects the primary if the ping fails
+func (c *Client) checkHealth() {
+	db, release := c.acquire()
+	if db == nil {
+		release()
+		logger.Log.Warn("no db connection, trying to reconnect...")
+		_ = c.reconnect(context.Background())
+		return
+	}
+
+	err := db.Ping()
+	release()
+	if err != nil {
+		ferr := ferror.FromError(err)
+		c.recordPing(ferr)
+		logger.Log.Warn("Ping failed, reconnecting... Error: " + err.Error())
+		_ = c.reconnect(context.Background())
+	} else {
+		c.recordPing(nil)
+	}
+
+	c.checkReplicas()
+}
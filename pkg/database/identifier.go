@@ -0,0 +1,35 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fabiokaelin/ferror"
+)
+
+// identifierPattern matches a plain table or column name
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidIdentifier reports if name can be put into a statement as table or column name, e.g. when it can not be passed as parameter.
+// A name may be qualified once ("app.users"), quoting and any other character are rejected.
+func ValidIdentifier(name string) bool {
+	qualifier, unqualified, qualified := strings.Cut(name, ".")
+	if !qualified {
+		return identifierPattern.MatchString(name)
+	}
+	return identifierPattern.MatchString(qualifier) && identifierPattern.MatchString(unqualified)
+}
+
+// checkIdentifiers returns an error for the first name which is not a valid identifier, statement describes where the names are used
+func checkIdentifiers(statement string, names ...string) ferror.FError {
+	for _, name := range names {
+		if !ValidIdentifier(name) {
+			ferr := ferror.New(fmt.Sprintf("invalid identifier %q in %s", name, statement))
+			ferr.SetLayer("db")
+			ferr.SetKind(KindExecution)
+			return ferr
+		}
+	}
+	return nil
+}
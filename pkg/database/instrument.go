@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+)
+
+type (
+	// QueryInfo describes a query passed to the hooks
+	QueryInfo struct {
+		Query    string        // query as passed by the caller
+		Args     []any         // query parameters
+		Start    time.Time     // time when the query was started
+		Duration time.Duration // runtime of the query, only set in AfterQuery. For RunSQL it ends when the rows are returned, reading them is not included.
+		Rows     int64         // returned or affected rows, -1 if unknown (e.g. for RunSQL), only set in AfterQuery
+		Err      error         // error of the query, only set in AfterQuery
+	}
+
+	// QueryHook is called around every query executed through this package, e.g. to collect metrics or add tracing spans
+	QueryHook interface {
+		// BeforeQuery is called before the query is sent, the returned context is used for the query and passed to AfterQuery
+		BeforeQuery(ctx context.Context, info *QueryInfo) context.Context
+		// AfterQuery is called after the query finished
+		AfterQuery(ctx context.Context, info *QueryInfo)
+	}
+)
+
+// AddQueryHook registers a hook which is called for every query of the default client
+func AddQueryHook(hook QueryHook) {
+	defaultClient.AddQueryHook(hook)
+}
+
+// AddQueryHook registers a hook which is called for every query of the client
+func (c *Client) AddQueryHook(hook QueryHook) {
+	c.hooksMutex.Lock()
+	defer c.hooksMutex.Unlock()
+	c.hooks = append(c.hooks, hook)
+}
+
+// observeQuery calls the before hooks and returns the context for the query and a function which has to be called with the result of the query
+func (c *Client) observeQuery(ctx context.Context, query string, parameters []any) (context.Context, func(rows int64, err error)) {
+	c.hooksMutex.RLock()
+	registered := c.hooks
+	c.hooksMutex.RUnlock()
+
+	info := &QueryInfo{Query: query, Args: parameters, Start: time.Now()}
+	for _, hook := range registered {
+		ctx = hook.BeforeQuery(ctx, info)
+	}
+
+	return ctx, func(rows int64, err error) {
+		info.Duration = time.Since(info.Start)
+		info.Rows = rows
+		info.Err = err
+		for _, hook := range registered {
+			hook.AfterQuery(ctx, info)
+		}
+
+		threshold := c.config.SlowQueryThreshold
+		if threshold > 0 && info.Duration >= threshold {
+			rowCount := ""
+			if rows >= 0 {
+				rowCount = fmt.Sprintf(", %d rows", rows)
+			}
+			logger.Log.Warn(fmt.Sprintf("slow query: %s%s, called from %s: %s", info.Duration.Round(time.Millisecond), rowCount, caller(), redactQuery(query)))
+		}
+	}
+}
+
+// caller returns file and line of the first function outside of this package
+func caller() string {
+	pc := make([]uintptr, 16)
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/fabiokaelin/fcommon/pkg/database.") {
+			return fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+	numberLiteral  = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	repeatedSpaces = regexp.MustCompile(`\s+`)
+)
+
+// redactQuery replaces all literals in query, so values which are not passed as parameter do not end up in the log
+func redactQuery(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numberLiteral.ReplaceAllString(query, "?")
+	return strings.TrimSpace(repeatedSpaces.ReplaceAllString(query, " "))
+}
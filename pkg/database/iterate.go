@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// scannerType is used to detect types which scan a whole column themselves
+var scannerType = reflect.TypeFor[sql.Scanner]()
+
+// Iterate executes a query and returns an iterator which scans one row after the other into T, see IterateWith
+func Iterate[T any](query string, parameters ...any) iter.Seq2[T, error] {
+	return IterateWith[T](context.Background(), defaultClient, query, parameters...)
+}
+
+// IterateContext executes a query bound to ctx and returns an iterator over the rows, see IterateWith
+func IterateContext[T any](ctx context.Context, query string, parameters ...any) iter.Seq2[T, error] {
+	return IterateWith[T](ctx, defaultClient, query, parameters...)
+}
+
+// IterateWith executes a query bound to ctx on q (a *Client, a *Tx or Client.Replica) and returns an iterator which scans the rows lazily into T.
+// Only one row is held in memory, so it can be used to export large tables:
+//
+//	for user, err := range database.IterateWith[User](ctx, client, "SELECT * FROM users") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The query is executed when the iteration starts and the rows are closed when it ends, also if the loop is left early.
+// Every error is a ferror.FError and ends the iteration. The default query timeout is not applied because reading a large
+// result may take longer than a single query, use ctx to bound the iteration.
+func IterateWith[T any](ctx context.Context, q Querier, query string, parameters ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var result T
+		// the pool stays acquired during the iteration, so a reconnect does not close it under the open rows
+		s, release := q.session()
+		defer release()
+		if s.db == nil {
+			yield(result, noConnectionError(query))
+			return
+		}
+
+		ctx, done := s.client.observeQuery(baseContext(ctx), query, parameters)
+		rows, err := s.db.QueryxContext(ctx, s.statement(ctx, query), parameters...)
+		if err != nil {
+			done(0, err)
+			yield(result, queryError(ctx, err, query))
+			return
+		}
+		defer rows.Close()
+
+		scan := scanFunc[T](rows)
+		var count int64
+		for rows.Next() {
+			var row T
+			err = scan(&row)
+			if err != nil {
+				done(count, err)
+				ferr := queryError(ctx, err, query)
+				ferr.SetInternal(fmt.Sprintf("error during scanning row %d of %s", count+1, query))
+				yield(result, ferr)
+				return
+			}
+			count++
+			if !yield(row, nil) {
+				done(count, nil)
+				return
+			}
+		}
+
+		err = rows.Err()
+		done(count, err)
+		if err != nil {
+			yield(result, queryError(ctx, err, query))
+		}
+	}
+}
+
+// scanFunc returns the function to scan a row into T. Structs are matched by their `db` tags like in Select,
+// every other type (and structs implementing sql.Scanner like sql.NullString) is scanned from a single column.
+func scanFunc[T any](rows *sqlx.Rows) func(*T) error {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(scannerType) || !hasExportedField(t) {
+		return func(row *T) error {
+			return rows.Scan(row)
+		}
+	}
+	return func(row *T) error {
+		return rows.StructScan(row)
+	}
+}
+
+// hasExportedField reports if a struct has a field sqlx can map a column to. Structs without (e.g. time.Time) are scanned as a single value.
+func hasExportedField(t reflect.Type) bool {
+	for i := range t.NumField() {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
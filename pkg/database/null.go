@@ -0,0 +1,89 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// Null is a value of a nullable column. Unlike sql.NullString and friends it is marshalled to null or the bare value in JSON,
+// so it can be used in structs which are returned by a handler. T can be any type database/sql can scan into, including UUID.
+type Null[T any] struct {
+	V     T
+	Valid bool // false if the column is NULL
+}
+
+// NewNull returns a valid Null containing v
+func NewNull[T any](v T) Null[T] {
+	return Null[T]{V: v, Valid: true}
+}
+
+// NullFromPtr returns a Null containing *v or an invalid Null if v is nil
+func NullFromPtr[T any](v *T) Null[T] {
+	if v == nil {
+		return Null[T]{}
+	}
+	return NewNull(*v)
+}
+
+// Ptr returns a pointer to the value or nil if it is NULL
+func (n Null[T]) Ptr() *T {
+	if !n.Valid {
+		return nil
+	}
+	v := n.V
+	return &v
+}
+
+// ValueOr returns the value or fallback if it is NULL
+func (n Null[T]) ValueOr(fallback T) T {
+	if !n.Valid {
+		return fallback
+	}
+	return n.V
+}
+
+// Scan implements sql.Scanner
+func (n *Null[T]) Scan(src any) error {
+	var null sql.Null[T]
+	err := null.Scan(src)
+	if err != nil {
+		return err
+	}
+	n.V, n.Valid = null.V, null.Valid
+	return nil
+}
+
+// Value implements driver.Valuer, NULL is returned if the value is not valid
+func (n Null[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	if valuer, ok := any(n.V).(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return driver.DefaultParameterConverter.ConvertValue(n.V)
+}
+
+// MarshalJSON implements json.Marshaler, an invalid value is marshalled to null
+func (n Null[T]) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.V)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, null results in an invalid value
+func (n *Null[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*n = Null[T]{}
+		return nil
+	}
+	err := json.Unmarshal(data, &n.V)
+	if err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
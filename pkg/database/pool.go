@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+)
+
+// pool is an open connection pool together with the operations which currently use it
+type pool struct {
+	db     *sqlx.DB
+	active sync.WaitGroup
+}
+
+// acquire returns the current connection pool and marks it as in use until release is called.
+// A pool is only closed after all operations which acquired it are released. db is nil if there is no connection.
+func (c *Client) acquire() (db *sqlx.DB, release func()) {
+	c.poolMutex.RLock()
+	defer c.poolMutex.RUnlock()
+	if c.current == nil {
+		return nil, func() {}
+	}
+	p := c.current
+	p.active.Add(1)
+	return p.db, p.active.Done
+}
+
+// openPool opens a new connection pool and checks that it works, the check is aborted when ctx is done
+func openPool(ctx context.Context, dbValues values.DatabaseValues) (*sqlx.DB, ferror.FError) {
+	dsn, ferr := buildDSN(dbValues)
+	if ferr != nil {
+		return nil, ferr
+	}
+	db, err := sqlx.Open(configuredDriver(dbValues), dsn)
+	if err != nil {
+		ferr := ferror.FromError(err)
+		ferr.SetLayer("db")
+		ferr.SetKind(KindConnection)
+		ferr.SetInternal("error during opening db connection")
+		return nil, ferr
+	}
+	// test if connection is working
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		ferr := ferror.FromError(err)
+		ferr.SetLayer("db")
+		ferr.SetKind(KindConnection)
+		ferr.SetInternal("ping to db failed")
+		return nil, ferr
+	}
+	configurePool(db)
+	return db, nil
+}
+
+// configurePool sets the pool limits of a connection
+func configurePool(db *sqlx.DB) {
+	db.SetMaxOpenConns(100)
+	db.SetMaxIdleConns(30)
+	maxLifeTime := time.Minute * 30
+	db.SetConnMaxLifetime(maxLifeTime)
+}
+
+// reconnect opens a new connection pool and swaps it with the current one. This is the only place where the pool is replaced.
+// If the new pool can not be opened the current one is kept.
+func (c *Client) reconnect(ctx context.Context) ferror.FError {
+	dbValues, passwordHash, ferr := c.connectionValues()
+	if ferr != nil {
+		c.recordPing(ferr)
+		return ferr
+	}
+	db, ferr := openPool(ctx, dbValues)
+	if ferr != nil {
+		c.recordPing(ferr)
+		return ferr
+	}
+
+	c.poolMutex.Lock()
+	if c.closed {
+		// the client was shut down while the new pool was opened
+		c.poolMutex.Unlock()
+		_ = db.Close()
+		return shutdownError()
+	}
+	old := c.current
+	c.current = &pool{db: db}
+	c.passwordHash = passwordHash
+	c.poolMutex.Unlock()
+
+	c.recordPing(nil)
+	if old != nil {
+		c.statusMutex.Lock()
+		c.status.Reconnects++
+		c.statusMutex.Unlock()
+	}
+
+	if old != nil {
+		go retire(old)
+	}
+	return nil
+}
+
+// retire closes a replaced pool as soon as no operation uses it anymore
+func retire(old *pool) {
+	old.active.Wait()
+	err := old.db.Close()
+	if err != nil {
+		logger.Log.Warn("closing old db connection failed: " + err.Error())
+	}
+}
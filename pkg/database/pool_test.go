@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	_ "modernc.org/sqlite"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+// newTestClient connects a client to an in-memory sqlite database which is shared by all connections of the client.
+// sqlite ignores the host, so every replica is a pool on the same database.
+func newTestClient(t *testing.T, replicaHosts ...string) *Client {
+	t.Helper()
+	return connectTestClient(t, values.DatabaseValues{ReplicaHosts: replicaHosts})
+}
+
+// connectTestClient connects a client like newTestClient with the given config, driver and database are set by it
+func connectTestClient(t *testing.T, config values.DatabaseValues) *Client {
+	t.Helper()
+	config.Driver = DriverSQLite
+	config.DatabaseName = "file:" + t.Name() + "?mode=memory&cache=shared"
+	c := NewClient(config)
+	ferr := c.Connect(context.Background())
+	if ferr != nil {
+		t.Fatalf("connect: %s", ferr.Error())
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	for _, query := range []string{
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+		"INSERT INTO items (id, name) VALUES (1, 'one'), (2, 'two'), (3, 'three')",
+	} {
+		_, ferr = ExecWith(context.Background(), c, query)
+		if ferr != nil {
+			t.Fatalf("prepare: %s", ferr.Error())
+		}
+	}
+	return c
+}
+
+// queryLoop runs queries on c from several goroutines until stop is closed and returns the number of queries and failed queries
+func queryLoop(c *Client, stop <-chan struct{}, workers int) (wait func() (queries int64, failed int64)) {
+	var wg sync.WaitGroup
+	var total, errors atomic.Int64
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				total.Add(1)
+
+				name, ferr := GetWith[string](context.Background(), c, "SELECT name FROM items WHERE id = ?", 2)
+				if ferr != nil || name != "two" {
+					errors.Add(1)
+					continue
+				}
+
+				// the rows are read after the pool was released, a reconnect or shutdown must not break them
+				rows, ferr := c.RunSQLContext(context.Background(), "SELECT id FROM items ORDER BY id")
+				if ferr != nil {
+					errors.Add(1)
+					continue
+				}
+				count := 0
+				for rows.Next() {
+					count++
+				}
+				if rows.Err() != nil || count != 3 {
+					errors.Add(1)
+				}
+				_ = rows.Close()
+			}
+		}()
+	}
+	return func() (int64, int64) {
+		wg.Wait()
+		return total.Load(), errors.Load()
+	}
+}
+
+func TestReconnectDuringQueries(t *testing.T) {
+	c := newTestClient(t)
+
+	stop := make(chan struct{})
+	wait := queryLoop(c, stop, 8)
+	const reconnects = 20
+	for range reconnects {
+		ferr := c.reconnect(context.Background())
+		if ferr != nil {
+			t.Errorf("reconnect: %s", ferr.Error())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+
+	queries, failed := wait()
+	if queries == 0 {
+		t.Fatal("no queries were executed")
+	}
+	if failed > 0 {
+		t.Errorf("%d of %d queries failed during reconnects", failed, queries)
+	}
+	if got := c.Status().Reconnects; got != reconnects {
+		t.Errorf("Reconnects = %d, want %d", got, reconnects)
+	}
+}
+
+func TestShutdownDuringQueries(t *testing.T) {
+	c := newTestClient(t)
+
+	stop := make(chan struct{})
+	wait := queryLoop(c, stop, 8)
+	reconnected := make(chan struct{})
+	go func() {
+		defer close(reconnected)
+		for {
+			ferr := c.reconnect(context.Background())
+			if ferr != nil {
+				if !IsShutdown(ferr) {
+					t.Errorf("reconnect: %s", ferr.Error())
+				}
+				return
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ferr := c.Shutdown(ctx)
+	if ferr != nil {
+		t.Fatalf("shutdown: %s", ferr.Error())
+	}
+	close(stop)
+	wait()
+	<-reconnected
+
+	_, ferr = GetWith[string](context.Background(), c, "SELECT name FROM items WHERE id = ?", 1)
+	if ferr == nil {
+		t.Error("query after shutdown succeeded")
+	}
+	ferr = c.Connect(context.Background())
+	if !IsShutdown(ferr) {
+		t.Errorf("Connect after shutdown returned %v, want an error of kind %s", ferr, KindShutdown)
+	}
+	if ferr := c.Shutdown(ctx); ferr != nil {
+		t.Errorf("second shutdown: %s", ferr.Error())
+	}
+}
+
+func TestShutdownWaitsForReplicaQueries(t *testing.T) {
+	c := newTestClient(t, "replica")
+	if _, ferr := GetWith[string](context.Background(), c.Replica(), "SELECT name FROM items WHERE id = ?", 3); ferr != nil {
+		t.Fatalf("replica query: %s", ferr.Error())
+	}
+
+	// a query which is still running on the replica
+	_, release := c.replicas[0].acquire()
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(released)
+		release()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ferr := c.Shutdown(ctx)
+	if ferr != nil {
+		t.Fatalf("shutdown: %s", ferr.Error())
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("Shutdown returned before the replica query was done")
+	}
+}
+
+func TestShutdownDeadlineWithReplicaQueries(t *testing.T) {
+	c := newTestClient(t, "replica")
+	_, release := c.replicas[0].acquire()
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ferr := c.Shutdown(ctx)
+	if !IsShutdown(ferr) {
+		t.Errorf("Shutdown returned %v, want an error of kind %s", ferr, KindShutdown)
+	}
+}
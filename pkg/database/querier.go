@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Querier is something queries can be executed on: a *Client, a *Tx or the replicas of a client (see Client.Replica)
+	Querier interface {
+		// session returns the connection to execute a query on, release has to be called when the query is done
+		session() (s session, release func())
+	}
+
+	// queryer is implemented by *sqlx.DB and *sqlx.Tx
+	queryer interface {
+		sqlx.QueryerContext
+		sqlx.ExecerContext
+		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+		Rebind(query string) string
+		BindNamed(query string, arg any) (string, []any, error)
+	}
+
+	// session is the connection a single query is executed on
+	session struct {
+		client *Client
+		db     queryer // nil if there is no connection
+	}
+
+	// replicaQuerier executes queries on the replicas of a client
+	replicaQuerier struct {
+		client *Client
+	}
+)
+
+// session returns the primary connection of the client
+func (c *Client) session() (session, func()) {
+	db, release := c.acquire()
+	if db == nil {
+		return session{client: c}, release
+	}
+	return session{client: c, db: db}, release
+}
+
+// statement returns query with the placeholders of the driver and the request comment if it is enabled
+func (s session) statement(ctx context.Context, query string) string {
+	return s.client.annotate(ctx, s.db.Rebind(query))
+}
+
+// Replica returns a Querier which executes read only queries on a healthy replica, or on the primary if no replica is available.
+// Replicas may lag behind, so reads which have to see a previous write must use the client itself.
+// Statements which write (ExecWith, BulkInsert, VersionedUpdate) are always executed on the primary.
+func (c *Client) Replica() Querier {
+	return replicaQuerier{client: c}
+}
+
+// primary returns the client of q if q executes on the replicas, writes must never be sent to a replica
+func primary(q Querier) Querier {
+	if r, ok := q.(replicaQuerier); ok {
+		return r.client
+	}
+	return q
+}
+
+// session returns a healthy replica or the primary if there is none
+func (r replicaQuerier) session() (session, func()) {
+	db, release := r.client.replicaDB()
+	if db == nil {
+		return r.client.session()
+	}
+	return session{client: r.client, db: db}, release
+}
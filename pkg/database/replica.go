@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+)
+
+// replica is a read only copy of the primary database
+type replica struct {
+	host    string
+	healthy atomic.Bool
+
+	// mutex guards current, which is replaced when the credentials are rotated and set to nil by Shutdown, and passwordHash
+	mutex   sync.RWMutex
+	current *pool
+	// passwordHash is the checksum of the password file content the current pool was opened with. It is tracked separately from the primary,
+	// because a reconnect of the primary (e.g. by the health check) may pick up a rotated password before the replicas are reopened.
+	passwordHash [32]byte
+}
+
+// acquire returns the connection pool of the replica and marks it as in use until release is called. db is nil after Shutdown.
+func (r *replica) acquire() (db *sqlx.DB, release func()) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.current == nil {
+		return nil, func() {}
+	}
+	p := r.current
+	p.active.Add(1)
+	return p.db, p.active.Done
+}
+
+// stats returns the statistics of the current pool of the replica
+func (r *replica) stats() sql.DBStats {
+	db, release := r.acquire()
+	defer release()
+	if db == nil {
+		return sql.DBStats{}
+	}
+	return db.Stats()
+}
+
+// openReplicaPool opens a pool for the replica on host, the credentials and options are taken from dbValues
+func openReplicaPool(dbValues values.DatabaseValues, host string) (*sqlx.DB, ferror.FError) {
+	dbValues.DatabaseHost = host
+	dbValues.Socket = ""
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		dbValues.DatabaseHost = h
+		dbValues.DatabasePort = port
+	}
+
+	dsn, ferr := buildDSN(dbValues)
+	if ferr != nil {
+		return nil, ferr
+	}
+	db, err := sqlx.Open(configuredDriver(dbValues), dsn)
+	if err != nil {
+		ferr := ferror.FromError(err)
+		ferr.SetLayer("db")
+		ferr.SetKind(KindConnection)
+		ferr.SetInternal("error during opening replica connection to " + host)
+		return nil, ferr
+	}
+	configurePool(db)
+	return db, nil
+}
+
+// openReplicas opens a pool for each configured replica. A replica which is not reachable is kept out of rotation until the health check can ping it.
+func (c *Client) openReplicas(ctx context.Context) {
+	c.replicas = nil
+	if len(c.config.ReplicaHosts) == 0 {
+		return
+	}
+	dbValues, passwordHash, ferr := c.connectionValues()
+	if ferr != nil {
+		logger.Log.Error("replicas: " + ferr.Message())
+		return
+	}
+	for _, host := range c.config.ReplicaHosts {
+		db, ferr := openReplicaPool(dbValues, host)
+		if ferr != nil {
+			logger.Log.Error("replica " + host + ": " + ferr.Message())
+			continue
+		}
+
+		r := &replica{host: host, current: &pool{db: db}, passwordHash: passwordHash}
+		err := db.PingContext(ctx)
+		if err != nil {
+			logger.Log.Warn("replica " + host + " not reachable: " + err.Error())
+		}
+		r.healthy.Store(err == nil)
+		c.replicas = append(c.replicas, r)
+	}
+}
+
+// replicasOutdated reports if a replica pool was opened with another password than the one with passwordHash
+func (c *Client) replicasOutdated(passwordHash [32]byte) bool {
+	for _, r := range c.replicas {
+		r.mutex.RLock()
+		outdated := r.current != nil && r.passwordHash != passwordHash
+		r.mutex.RUnlock()
+		if outdated {
+			return true
+		}
+	}
+	return false
+}
+
+// reopenReplicas replaces the pools of all replicas which were not opened with the password of passwordHash with new ones using dbValues.
+// Like a reconnect of the primary, the old pools are closed as soon as the queries running on them are done.
+func (c *Client) reopenReplicas(dbValues values.DatabaseValues, passwordHash [32]byte) {
+	for _, r := range c.replicas {
+		r.mutex.RLock()
+		current := r.passwordHash == passwordHash
+		r.mutex.RUnlock()
+		if current {
+			continue
+		}
+
+		db, ferr := openReplicaPool(dbValues, r.host)
+		if ferr != nil {
+			logger.Log.Error("replica " + r.host + ": " + ferr.Message())
+			continue
+		}
+
+		r.mutex.Lock()
+		old := r.current
+		if old == nil {
+			// the client was shut down in the meantime
+			r.mutex.Unlock()
+			_ = db.Close()
+			continue
+		}
+		r.current = &pool{db: db}
+		r.passwordHash = passwordHash
+		r.mutex.Unlock()
+		go retire(old)
+	}
+}
+
+// checkReplicas pings all replicas and takes failing ones out of rotation
+func (c *Client) checkReplicas() {
+	for _, r := range c.replicas {
+		db, release := r.acquire()
+		if db == nil {
+			release()
+			continue
+		}
+		err := db.Ping()
+		release()
+		wasHealthy := r.healthy.Swap(err == nil)
+		if err != nil && wasHealthy {
+			logger.Log.Warn("replica " + r.host + " removed from rotation: " + err.Error())
+		} else if err == nil && !wasHealthy {
+			logger.Log.Info("replica " + r.host + " back in rotation")
+		}
+	}
+}
+
+// replicaDB returns the next healthy replica round robin, marked as in use until release is called. db is nil if there is none.
+func (c *Client) replicaDB() (db *sqlx.DB, release func()) {
+	count := uint64(len(c.replicas))
+	start := c.nextReplica.Add(1)
+	for i := range count {
+		r := c.replicas[(start+i)%count]
+		if !r.healthy.Load() {
+			continue
+		}
+		db, release := r.acquire()
+		if db != nil {
+			return db, release
+		}
+		release()
+	}
+	return nil, func() {}
+}
+
+// RunSQLReplicaContext executes a read only query bound to ctx on a replica, or on the primary if no replica is available
+func (c *Client) RunSQLReplicaContext(ctx context.Context, query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return runSQL(ctx, c.Replica(), query, parameters...)
+}
+
+// RunSQLReplica executes a read only query on a replica, or on the primary if no replica is available.
+// Replicas may lag behind, so reads which have to see a previous write must use RunSQL.
+func RunSQLReplica(query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return defaultClient.RunSQLReplicaContext(context.Background(), query, parameters...)
+}
+
+// RunSQLReplicaContext executes a read only query bound to ctx on a replica
+func RunSQLReplicaContext(ctx context.Context, query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return defaultClient.RunSQLReplicaContext(ctx, query, parameters...)
+}
+
+// SelectReplica is like Select, but reads from a replica
+func SelectReplica[T any](query string, parameters ...any) ([]T, ferror.FError) {
+	return SelectWith[T](context.Background(), defaultClient.Replica(), query, parameters...)
+}
+
+// SelectReplicaContext is like SelectContext, but reads from a replica
+func SelectReplicaContext[T any](ctx context.Context, query string, parameters ...any) ([]T, ferror.FError) {
+	return SelectWith[T](ctx, defaultClient.Replica(), query, parameters...)
+}
+
+// GetReplica is like Get, but reads from a replica
+func GetReplica[T any](query string, parameters ...any) (T, ferror.FError) {
+	return GetWith[T](context.Background(), defaultClient.Replica(), query, parameters...)
+}
+
+// GetReplicaContext is like GetContext, but reads from a replica
+func GetReplicaContext[T any](ctx context.Context, query string, parameters ...any) (T, ferror.FError) {
+	return GetWith[T](ctx, defaultClient.Replica(), query, parameters...)
+}
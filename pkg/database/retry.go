@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	"github.com/fabiokaelin/ferror"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultMultiplier     = 2
+	defaultJitter         = 0.1
+)
+
+// withRetryDefaults fills all unset fields of policy with the defaults
+func withRetryDefaults(policy values.RetryValues) values.RetryValues {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = defaultInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultMaxBackoff
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = defaultMultiplier
+	}
+	switch {
+	case policy.Jitter == 0:
+		policy.Jitter = defaultJitter
+	case policy.Jitter < 0:
+		// a negative jitter disables it, e.g. for tests which expect exact waits
+		policy.Jitter = 0
+	}
+	return policy
+}
+
+// backoff returns the wait after the given failed attempt (starting at 1) including jitter
+func backoff(policy values.RetryValues, attempt int) time.Duration {
+	wait := float64(policy.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		wait *= policy.Multiplier
+	}
+	wait = min(wait, float64(policy.MaxBackoff))
+	wait += wait * policy.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(wait)
+}
+
+// connectWithRetry opens the database connection and retries according to the ConnectRetry policy until it succeeds,
+// all attempts are used up, the deadline of the policy is reached or ctx is done
+func (c *Client) connectWithRetry(ctx context.Context) ferror.FError {
+	policy := withRetryDefaults(c.config.ConnectRetry)
+	if policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Deadline)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		ferr := c.reconnect(ctx)
+		if ferr == nil {
+			if attempt > 1 {
+				logger.Log.Info(fmt.Sprintf("database connection established after %d attempts", attempt))
+			}
+			return nil
+		}
+		if IsShutdown(ferr) {
+			// retrying can not help, the client stays closed
+			return ferr
+		}
+		logger.Log.Warn(fmt.Sprintf("database connection attempt %d/%d failed: %s", attempt, policy.MaxAttempts, ferr.Message()))
+		if attempt >= policy.MaxAttempts {
+			return ferr
+		}
+
+		wait := backoff(policy, attempt)
+		select {
+		case <-ctx.Done():
+			ferr := ferror.FromError(ctx.Err())
+			ferr.SetLayer("db")
+			ferr.SetKind(KindConnection)
+			ferr.SetInternal(fmt.Sprintf("gave up connecting to the database after %d attempts", attempt))
+			return ferr
+		case <-time.After(wait):
+		}
+	}
+}
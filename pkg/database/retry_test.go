@@ -0,0 +1,31 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/values"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := withRetryDefaults(values.RetryValues{Jitter: -1, MaxBackoff: 5 * time.Second})
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, wait := range want {
+		if got := backoff(policy, i+1); got != wait {
+			t.Errorf("backoff after attempt %d = %s, want %s", i+1, got, wait)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := withRetryDefaults(values.RetryValues{})
+	if policy.Jitter != defaultJitter {
+		t.Fatalf("Jitter = %v, want the default %v", policy.Jitter, defaultJitter)
+	}
+	for range 100 {
+		got := backoff(policy, 2)
+		if got < 1800*time.Millisecond || got > 2200*time.Millisecond {
+			t.Fatalf("backoff after attempt 2 = %s, want 2s ±10%%", got)
+		}
+	}
+}
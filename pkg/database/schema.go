@@ -0,0 +1,343 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fabiokaelin/fcommon/pkg/migrations"
+	"github.com/fabiokaelin/ferror"
+)
+
+type (
+	// Schema describes the tables of a database. It can be declared in code, read from the database with InspectSchema
+	// or stored as JSON, e.g. a snapshot of a database which is known to be correct.
+	Schema struct {
+		Tables []Table `json:"tables"`
+	}
+
+	// Table is a table of a schema
+	Table struct {
+		Name    string   `json:"name"`
+		Columns []Column `json:"columns"`
+		Indexes []Index  `json:"indexes,omitempty"` // nil skips the comparison of the indexes
+	}
+
+	// Column is a column of a table
+	Column struct {
+		Name     string `json:"name"`
+		Type     string `json:"type"` // full type as in information_schema.COLUMNS.COLUMN_TYPE, e.g. "varchar(255)" or "int unsigned"
+		Nullable bool   `json:"nullable"`
+	}
+
+	// Index is an index of a table, the primary key is named "PRIMARY"
+	Index struct {
+		Name    string   `json:"name"`
+		Columns []string `json:"columns"`
+		Unique  bool     `json:"unique"`
+	}
+
+	// SchemaDiff is the difference between the expected and the actual schema. Expected and actual values are kept,
+	// so the diff can be returned as JSON by an internal endpoint.
+	SchemaDiff struct {
+		MissingTables    []string       `json:"missingTables,omitempty"`    // expected, but not in the database
+		UnexpectedTables []string       `json:"unexpectedTables,omitempty"` // in the database, but not expected
+		Tables           []TableDiff    `json:"tables,omitempty"`
+		Migrations       *MigrationDiff `json:"migrations,omitempty"` // nil if no migrations are set
+	}
+
+	// TableDiff is the difference of a table which exists in both schemas
+	TableDiff struct {
+		Table             string       `json:"table"`
+		MissingColumns    []string     `json:"missingColumns,omitempty"`
+		UnexpectedColumns []string     `json:"unexpectedColumns,omitempty"`
+		ChangedColumns    []ColumnDiff `json:"changedColumns,omitempty"`
+		MissingIndexes    []string     `json:"missingIndexes,omitempty"`
+		UnexpectedIndexes []string     `json:"unexpectedIndexes,omitempty"`
+		ChangedIndexes    []IndexDiff  `json:"changedIndexes,omitempty"`
+	}
+
+	// ColumnDiff is a column whose type or nullability differs
+	ColumnDiff struct {
+		Expected Column `json:"expected"`
+		Actual   Column `json:"actual"`
+	}
+
+	// IndexDiff is an index whose columns or uniqueness differ
+	IndexDiff struct {
+		Expected Index `json:"expected"`
+		Actual   Index `json:"actual"`
+	}
+
+	// MigrationDiff is the difference between the migration files and the schema_migrations table
+	MigrationDiff struct {
+		Pending  []int64 `json:"pending,omitempty"`  // versions of files which are not applied
+		Unknown  []int64 `json:"unknown,omitempty"`  // applied versions without a file, e.g. applied by a newer release
+		Modified []int64 `json:"modified,omitempty"` // applied versions whose file was changed afterwards
+	}
+)
+
+// integerWidthPattern matches the display width of integer types, which mysql 8 does not report anymore
+var integerWidthPattern = regexp.MustCompile(`^((?:tiny|small|medium|big)?int)\(\d+\)`)
+
+// Empty reports if the schemas match
+func (d SchemaDiff) Empty() bool {
+	return len(d.MissingTables) == 0 && len(d.UnexpectedTables) == 0 && len(d.Tables) == 0 && (d.Migrations == nil || d.Migrations.Empty())
+}
+
+// Empty reports if all migration files are applied unchanged
+func (d MigrationDiff) Empty() bool {
+	return len(d.Pending) == 0 && len(d.Unknown) == 0 && len(d.Modified) == 0
+}
+
+// SetExpectedSchema sets the schema of the default client which CheckSchema compares against
+func SetExpectedSchema(schema Schema) {
+	defaultClient.SetExpectedSchema(schema)
+}
+
+// SetExpectedSchema sets the schema which CheckSchema compares against
+func (c *Client) SetExpectedSchema(schema Schema) {
+	c.expectedSchema = &schema
+}
+
+// SchemaCheckConfigured reports if the default client has an expected schema or migrations to compare against
+func SchemaCheckConfigured() bool {
+	return defaultClient.SchemaCheckConfigured()
+}
+
+// SchemaCheckConfigured reports if CheckSchema has anything to compare, otherwise its diff is always empty
+func (c *Client) SchemaCheckConfigured() bool {
+	return c.expectedSchema != nil || c.migrations != nil
+}
+
+// InspectSchema reads the schema of the database of the default client
+func InspectSchema(ctx context.Context) (Schema, ferror.FError) {
+	return defaultClient.InspectSchema(ctx)
+}
+
+// CheckSchema compares the database of the default client against the expected schema and the migrations
+func CheckSchema(ctx context.Context) (SchemaDiff, ferror.FError) {
+	return defaultClient.CheckSchema(ctx)
+}
+
+// InspectSchema reads the tables, columns and indexes of the connected database from information_schema. Only mysql is supported.
+func (c *Client) InspectSchema(ctx context.Context) (Schema, ferror.FError) {
+	if driverName := configuredDriver(c.config); driverName != DriverMySQL {
+		ferr := ferror.New("schema inspection is not supported for " + driverName)
+		ferr.SetLayer("db")
+		ferr.SetKind(KindExecution)
+		return Schema{}, ferr
+	}
+
+	tableNames, ferr := SelectWith[string](ctx, c, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME")
+	if ferr != nil {
+		return Schema{}, ferr
+	}
+
+	type columnRow struct {
+		Table    string `db:"table_name"`
+		Name     string `db:"column_name"`
+		Type     string `db:"column_type"`
+		Nullable string `db:"is_nullable"`
+	}
+	columns, ferr := SelectWith[columnRow](ctx, c, "SELECT TABLE_NAME AS table_name, COLUMN_NAME AS column_name, COLUMN_TYPE AS column_type, IS_NULLABLE AS is_nullable "+
+		"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, ORDINAL_POSITION")
+	if ferr != nil {
+		return Schema{}, ferr
+	}
+
+	type indexRow struct {
+		Table     string `db:"table_name"`
+		Name      string `db:"index_name"`
+		Column    string `db:"column_name"`
+		NonUnique int    `db:"non_unique"`
+	}
+	// functional indexes have no column name
+	indexes, ferr := SelectWith[indexRow](ctx, c, "SELECT TABLE_NAME AS table_name, INDEX_NAME AS index_name, COALESCE(COLUMN_NAME, '') AS column_name, NON_UNIQUE AS non_unique "+
+		"FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX")
+	if ferr != nil {
+		return Schema{}, ferr
+	}
+
+	byName := make(map[string]*Table, len(tableNames))
+	schema := Schema{Tables: make([]Table, len(tableNames))}
+	for i, name := range tableNames {
+		schema.Tables[i] = Table{Name: name, Columns: []Column{}, Indexes: []Index{}}
+		byName[name] = &schema.Tables[i]
+	}
+	for _, column := range columns {
+		table, ok := byName[column.Table]
+		if !ok {
+			// a view
+			continue
+		}
+		table.Columns = append(table.Columns, Column{Name: column.Name, Type: column.Type, Nullable: column.Nullable == "YES"})
+	}
+	for _, index := range indexes {
+		table, ok := byName[index.Table]
+		if !ok {
+			continue
+		}
+		if n := len(table.Indexes); n > 0 && table.Indexes[n-1].Name == index.Name {
+			table.Indexes[n-1].Columns = append(table.Indexes[n-1].Columns, index.Column)
+			continue
+		}
+		table.Indexes = append(table.Indexes, Index{Name: index.Name, Columns: []string{index.Column}, Unique: index.NonUnique == 0})
+	}
+	return schema, nil
+}
+
+// CheckSchema compares the connected database against the schema set with SetExpectedSchema and the migration files set with SetMigrations.
+// Both comparisons are skipped if nothing is set. The migration table itself is never reported as unexpected.
+func (c *Client) CheckSchema(ctx context.Context) (SchemaDiff, ferror.FError) {
+	diff := SchemaDiff{}
+	if c.expectedSchema != nil {
+		actual, ferr := c.InspectSchema(ctx)
+		if ferr != nil {
+			return SchemaDiff{}, ferr
+		}
+		diff = DiffSchema(*c.expectedSchema, actual)
+		diff.UnexpectedTables = slices.DeleteFunc(diff.UnexpectedTables, func(table string) bool {
+			return table == migrations.TableName
+		})
+	}
+
+	if c.migrations != nil {
+		migrationDiff, ferr := c.diffMigrations(ctx)
+		if ferr != nil {
+			return SchemaDiff{}, ferr
+		}
+		diff.Migrations = &migrationDiff
+	}
+	return diff, nil
+}
+
+// diffMigrations compares the migration files with the schema_migrations table
+func (c *Client) diffMigrations(ctx context.Context) (MigrationDiff, ferror.FError) {
+	files, ferr := migrations.Load(c.migrations)
+	if ferr != nil {
+		return MigrationDiff{}, ferr
+	}
+	db, release := c.acquire()
+	defer release()
+	if db == nil {
+		return MigrationDiff{}, noConnectionError("SELECT FROM " + migrations.TableName)
+	}
+	history, ferr := migrations.History(ctx, db)
+	if ferr != nil {
+		return MigrationDiff{}, ferr
+	}
+
+	checksums := make(map[int64]string, len(history))
+	for _, applied := range history {
+		checksums[applied.Version] = applied.Checksum
+	}
+	diff := MigrationDiff{}
+	for _, file := range files {
+		checksum, ok := checksums[file.Version]
+		switch {
+		case !ok:
+			diff.Pending = append(diff.Pending, file.Version)
+		case checksum != file.Checksum:
+			diff.Modified = append(diff.Modified, file.Version)
+		}
+		delete(checksums, file.Version)
+	}
+	for version := range checksums {
+		diff.Unknown = append(diff.Unknown, version)
+	}
+	slices.Sort(diff.Unknown)
+	return diff, nil
+}
+
+// DiffSchema compares two schemas. Names are compared case insensitive, types without the display width of integers
+// (int(11) equals int), because mysql 8 does not report it anymore.
+func DiffSchema(expected Schema, actual Schema) SchemaDiff {
+	diff := SchemaDiff{}
+	actualTables := map[string]Table{}
+	for _, table := range actual.Tables {
+		actualTables[strings.ToLower(table.Name)] = table
+	}
+
+	for _, expectedTable := range expected.Tables {
+		key := strings.ToLower(expectedTable.Name)
+		actualTable, ok := actualTables[key]
+		if !ok {
+			diff.MissingTables = append(diff.MissingTables, expectedTable.Name)
+			continue
+		}
+		delete(actualTables, key)
+		if tableDiff := diffTable(expectedTable, actualTable); tableDiff != nil {
+			diff.Tables = append(diff.Tables, *tableDiff)
+		}
+	}
+	for _, table := range actualTables {
+		diff.UnexpectedTables = append(diff.UnexpectedTables, table.Name)
+	}
+	slices.Sort(diff.UnexpectedTables)
+	return diff
+}
+
+// diffTable compares the columns and indexes of a table, nil is returned if they match
+func diffTable(expected Table, actual Table) *TableDiff {
+	diff := TableDiff{Table: expected.Name}
+
+	actualColumns := map[string]Column{}
+	for _, column := range actual.Columns {
+		actualColumns[strings.ToLower(column.Name)] = column
+	}
+	for _, expectedColumn := range expected.Columns {
+		key := strings.ToLower(expectedColumn.Name)
+		actualColumn, ok := actualColumns[key]
+		if !ok {
+			diff.MissingColumns = append(diff.MissingColumns, expectedColumn.Name)
+			continue
+		}
+		delete(actualColumns, key)
+		if normalizeType(expectedColumn.Type) != normalizeType(actualColumn.Type) || expectedColumn.Nullable != actualColumn.Nullable {
+			diff.ChangedColumns = append(diff.ChangedColumns, ColumnDiff{Expected: expectedColumn, Actual: actualColumn})
+		}
+	}
+	for _, column := range actual.Columns {
+		if _, ok := actualColumns[strings.ToLower(column.Name)]; ok {
+			diff.UnexpectedColumns = append(diff.UnexpectedColumns, column.Name)
+		}
+	}
+
+	if expected.Indexes != nil {
+		actualIndexes := map[string]Index{}
+		for _, index := range actual.Indexes {
+			actualIndexes[strings.ToLower(index.Name)] = index
+		}
+		for _, expectedIndex := range expected.Indexes {
+			key := strings.ToLower(expectedIndex.Name)
+			actualIndex, ok := actualIndexes[key]
+			if !ok {
+				diff.MissingIndexes = append(diff.MissingIndexes, expectedIndex.Name)
+				continue
+			}
+			delete(actualIndexes, key)
+			if expectedIndex.Unique != actualIndex.Unique || !slices.EqualFunc(expectedIndex.Columns, actualIndex.Columns, strings.EqualFold) {
+				diff.ChangedIndexes = append(diff.ChangedIndexes, IndexDiff{Expected: expectedIndex, Actual: actualIndex})
+			}
+		}
+		for _, index := range actual.Indexes {
+			if _, ok := actualIndexes[strings.ToLower(index.Name)]; ok {
+				diff.UnexpectedIndexes = append(diff.UnexpectedIndexes, index.Name)
+			}
+		}
+	}
+
+	if len(diff.MissingColumns) == 0 && len(diff.UnexpectedColumns) == 0 && len(diff.ChangedColumns) == 0 &&
+		len(diff.MissingIndexes) == 0 && len(diff.UnexpectedIndexes) == 0 && len(diff.ChangedIndexes) == 0 {
+		return nil
+	}
+	return &diff
+}
+
+// normalizeType returns a type in lower case without the display width of integers
+func normalizeType(columnType string) string {
+	columnType = strings.ToLower(strings.TrimSpace(columnType))
+	return integerWidthPattern.ReplaceAllString(columnType, "$1")
+}
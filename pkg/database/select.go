@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+)
+
+// Select executes a query and scans all rows into a slice of T. Struct fields are matched by their `db` tag.
+func Select[T any](query string, parameters ...any) ([]T, ferror.FError) {
+	return SelectWith[T](context.Background(), defaultClient, query, parameters...)
+}
+
+// SelectContext executes a query bound to ctx and scans all rows into a slice of T
+func SelectContext[T any](ctx context.Context, query string, parameters ...any) ([]T, ferror.FError) {
+	return SelectWith[T](ctx, defaultClient, query, parameters...)
+}
+
+// SelectWith executes a query bound to ctx on q (a *Client, a *Tx or Client.Replica) and scans all rows into a slice of T
+func SelectWith[T any](ctx context.Context, q Querier, query string, parameters ...any) ([]T, ferror.FError) {
+	s, release := q.session()
+	defer release()
+	if s.db == nil {
+		return nil, noConnectionError(query)
+	}
+	ctx, cancel := s.client.queryContext(ctx)
+	defer cancel()
+
+	result := []T{}
+	ctx, done := s.client.observeQuery(ctx, query, parameters)
+	err := sqlx.SelectContext(ctx, s.db, &result, s.statement(ctx, query), parameters...)
+	done(int64(len(result)), err)
+	if err != nil {
+		return nil, queryError(ctx, err, query)
+	}
+	return result, nil
+}
+
+// Get executes a query and scans the first row into T. If there is no row an error of kind KindNotFound is returned.
+func Get[T any](query string, parameters ...any) (T, ferror.FError) {
+	return GetWith[T](context.Background(), defaultClient, query, parameters...)
+}
+
+// GetContext executes a query bound to ctx and scans the first row into T
+func GetContext[T any](ctx context.Context, query string, parameters ...any) (T, ferror.FError) {
+	return GetWith[T](ctx, defaultClient, query, parameters...)
+}
+
+// GetWith executes a query bound to ctx on q (a *Client, a *Tx or Client.Replica) and scans the first row into T
+func GetWith[T any](ctx context.Context, q Querier, query string, parameters ...any) (T, ferror.FError) {
+	var result T
+	s, release := q.session()
+	defer release()
+	if s.db == nil {
+		return result, noConnectionError(query)
+	}
+	ctx, cancel := s.client.queryContext(ctx)
+	defer cancel()
+
+	ctx, done := s.client.observeQuery(ctx, query, parameters)
+	err := sqlx.GetContext(ctx, s.db, &result, s.statement(ctx, query), parameters...)
+	if err == nil {
+		done(1, nil)
+	} else {
+		done(0, err)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		ferr := ferror.New("no row found")
+		ferr.SetLayer("db")
+		ferr.SetKind(KindNotFound)
+		ferr.SetUserMsg(notFoundMessage)
+		ferr.SetInternal("no row returned by " + query)
+		return result, ferr
+	}
+	if err != nil {
+		return result, queryError(ctx, err, query)
+	}
+	return result, nil
+}
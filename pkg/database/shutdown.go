@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/ferror"
+)
+
+// defaultShutdownTimeout is how long Close waits for running queries
+const defaultShutdownTimeout = 30 * time.Second
+
+// Shutdown stops the health check and closes the default client, see Client.Shutdown.
+// The default client can not be connected again afterwards, so it should only be called when the process exits.
+func Shutdown(ctx context.Context) ferror.FError {
+	return defaultClient.Shutdown(ctx)
+}
+
+// Close shuts the default client down and waits up to 30 seconds for running queries. Like Shutdown the default client can not be connected again afterwards.
+func Close() ferror.FError {
+	return defaultClient.Close()
+}
+
+// Close shuts the client down and waits up to 30 seconds for running queries
+func (c *Client) Close() ferror.FError {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	return c.Shutdown(ctx)
+}
+
+// Shutdown stops the health check, rejects new queries and waits until all running queries and transactions on the primary
+// and the replicas are done or ctx is done. Afterwards all connection pools are closed. Calling it again returns the result of the first call.
+// A client which was shut down can not be connected again, Connect returns an error of kind KindShutdown; use NewClient for a new connection.
+func (c *Client) Shutdown(ctx context.Context) ferror.FError {
+	c.shutdownOnce.Do(func() {
+		close(c.stop)
+
+		c.poolMutex.Lock()
+		pools := []*pool{}
+		if c.current != nil {
+			pools = append(pools, c.current)
+		}
+		c.current = nil
+		c.closed = true
+		c.poolMutex.Unlock()
+		for _, r := range c.replicas {
+			r.mutex.Lock()
+			if r.current != nil {
+				pools = append(pools, r.current)
+			}
+			r.current = nil
+			r.mutex.Unlock()
+		}
+
+		c.statusMutex.Lock()
+		c.status.Connected = false
+		c.statusMutex.Unlock()
+
+		// the primary and the replicas are drained under the same deadline
+		drained := make(chan struct{})
+		go func() {
+			for _, p := range pools {
+				p.active.Wait()
+			}
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			logger.Log.Warn("database shutdown deadline reached, closing with running queries")
+			ferr := ferror.FromError(ctx.Err())
+			ferr.SetLayer("db")
+			ferr.SetKind(KindShutdown)
+			ferr.SetInternal("running queries did not finish before the shutdown deadline")
+			c.shutdownErr = ferr
+		}
+
+		for _, p := range pools {
+			err := p.db.Close()
+			if err != nil && c.shutdownErr == nil {
+				ferr := ferror.FromError(err)
+				ferr.SetLayer("db")
+				ferr.SetKind(KindShutdown)
+				ferr.SetInternal("error during closing db connection")
+				c.shutdownErr = ferr
+			}
+		}
+	})
+	return c.shutdownErr
+}
+
+// shutdownError returns the error for an operation on a client which was shut down
+func shutdownError() ferror.FError {
+	ferr := ferror.New("db client is shut down")
+	ferr.SetLayer("db")
+	ferr.SetKind(KindShutdown)
+	return ferr
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// TxOptions configures a transaction started with RunInTransaction
+	TxOptions struct {
+		Isolation  sql.IsolationLevel // isolation level, default is the one of the database server
+		ReadOnly   bool               // start a read only transaction
+		MaxRetries int                // how often the transaction is retried after a deadlock or lock wait timeout, default 3, negative disables retries
+	}
+
+	// Tx is a running transaction. It is only valid inside the callback of RunInTransaction.
+	Tx struct {
+		client *Client
+		tx     *sqlx.Tx
+		ctx    context.Context
+		depth  int // number of open savepoints
+	}
+
+	// TxFunc is the callback executed inside a transaction
+	TxFunc func(tx *Tx) ferror.FError
+
+	// txBeginner is implemented by *sqlx.DB and *sqlx.Conn
+	txBeginner interface {
+		BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+	}
+)
+
+const (
+	defaultTxRetries = 3
+	txRetryBackoff   = 50 * time.Millisecond
+)
+
+// RunInTransaction runs fn inside a transaction on the default client, see Client.RunInTransaction
+func RunInTransaction(ctx context.Context, opts *TxOptions, fn TxFunc) ferror.FError {
+	return defaultClient.RunInTransaction(ctx, opts, fn)
+}
+
+// RunInTransaction runs fn inside a transaction. The transaction is committed if fn returns nil and rolled back otherwise.
+// On a deadlock or a lock wait timeout the whole callback is retried with backoff, so fn must not have side effects outside of the transaction.
+func (c *Client) RunInTransaction(ctx context.Context, opts *TxOptions, fn TxFunc) ferror.FError {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	return c.retryTransaction(ctx, opts, func(ctx context.Context) ferror.FError {
+		return c.runTransaction(ctx, opts, fn)
+	})
+}
+
+// RunInSessionTransaction runs fn like RunInTransaction, but on a dedicated connection on which setup is executed before and reset after
+// the transaction, e.g. to change a session variable only for it. If reset fails the connection is closed instead of being returned
+// to the pool, so the setting can never leak into other queries.
+func (c *Client) RunInSessionTransaction(ctx context.Context, opts *TxOptions, setup string, reset string, fn TxFunc) ferror.FError {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	return c.retryTransaction(ctx, opts, func(ctx context.Context) ferror.FError {
+		return c.runSessionTransaction(ctx, opts, setup, reset, fn)
+	})
+}
+
+// retryTransaction calls run until it succeeds, fails with an error which can not be retried or the retries of opts are used up
+func (c *Client) retryTransaction(ctx context.Context, opts *TxOptions, run func(ctx context.Context) ferror.FError) ferror.FError {
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = defaultTxRetries
+	}
+
+	ctx = baseContext(ctx)
+	for attempt := 0; ; attempt++ {
+		ferr := run(ctx)
+		if ferr == nil || !isRetryable(ferr) || attempt >= retries {
+			return ferr
+		}
+		logger.Log.Warn(fmt.Sprintf("transaction failed (%s), retrying (%d/%d)", ferr.Kind(), attempt+1, retries))
+
+		backoff := txRetryBackoff << attempt
+		backoff += rand.N(backoff)
+		select {
+		case <-ctx.Done():
+			return queryError(ctx, ctx.Err(), "transaction retry")
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// runTransaction runs a single attempt of a transaction
+func (c *Client) runTransaction(ctx context.Context, opts *TxOptions, fn TxFunc) ferror.FError {
+	db, release := c.acquire()
+	defer release()
+	if db == nil {
+		return noConnectionError("BEGIN")
+	}
+	return c.runTransactionOn(ctx, db, opts, fn)
+}
+
+// runSessionTransaction runs a single attempt of a transaction on a dedicated connection, see RunInSessionTransaction
+func (c *Client) runSessionTransaction(ctx context.Context, opts *TxOptions, setup string, reset string, fn TxFunc) ferror.FError {
+	db, release := c.acquire()
+	defer release()
+	if db == nil {
+		return noConnectionError(setup)
+	}
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return queryError(ctx, err, setup)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, setup)
+	if err != nil {
+		// it is unknown whether the setting was applied
+		discardConn(conn)
+		return queryError(ctx, err, setup)
+	}
+	defer func() {
+		// reset also if ctx was cancelled, otherwise the connection would have to be discarded
+		resetCtx, cancel := c.queryContext(context.WithoutCancel(ctx))
+		defer cancel()
+		_, err := conn.ExecContext(resetCtx, reset)
+		if err != nil {
+			logger.Log.Warn("resetting the session failed, discarding the connection: " + err.Error())
+			discardConn(conn)
+		}
+	}()
+	return c.runTransactionOn(ctx, conn, opts, fn)
+}
+
+// discardConn marks conn as broken, so it is closed instead of being returned to the pool
+func discardConn(conn *sqlx.Conn) {
+	_ = conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+}
+
+// runTransactionOn runs a single attempt of a transaction on db, which is a pool or a dedicated connection
+func (c *Client) runTransactionOn(ctx context.Context, db txBeginner, opts *TxOptions, fn TxFunc) (ferr ferror.FError) {
+	sqlTx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return queryError(ctx, err, "BEGIN")
+	}
+	tx := &Tx{client: c, tx: sqlTx, ctx: ctx}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	ferr = fn(tx)
+	if ferr != nil {
+		err = sqlTx.Rollback()
+		if err != nil {
+			logger.Log.Warn("rollback failed: " + err.Error())
+		}
+		return ferr
+	}
+	err = sqlTx.Commit()
+	if err != nil {
+		return queryError(ctx, err, "COMMIT")
+	}
+	return nil
+}
+
+// isRetryable reports if a transaction which failed with ferr can be retried
+func isRetryable(ferr ferror.FError) bool {
+	return IsDeadlock(ferr) || IsLockTimeout(ferr)
+}
+
+// session returns the connection of the transaction
+func (tx *Tx) session() (session, func()) {
+	return session{client: tx.client, db: tx.tx}, func() {}
+}
+
+// RunSQL executes a query inside the transaction
+func (tx *Tx) RunSQL(query string, parameters ...any) (*sql.Rows, ferror.FError) {
+	return runSQL(tx.ctx, tx, query, parameters...)
+}
+
+// RunSQLRow executes a query inside the transaction and returns a row
+func (tx *Tx) RunSQLRow(query string, parameters ...any) (*sql.Row, ferror.FError) {
+	return runSQLRow(tx.ctx, tx, query, parameters...)
+}
+
+// RunInSavepoint runs fn inside a savepoint of the transaction. If fn returns an error only the changes since the savepoint are rolled back.
+func (tx *Tx) RunInSavepoint(fn TxFunc) ferror.FError {
+	name := fmt.Sprintf("sp_%d", tx.depth+1)
+	_, err := tx.tx.ExecContext(tx.ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return queryError(tx.ctx, err, "SAVEPOINT "+name)
+	}
+
+	nested := &Tx{client: tx.client, tx: tx.tx, ctx: tx.ctx, depth: tx.depth + 1}
+	ferr := fn(nested)
+	if ferr != nil {
+		// a deadlock already rolled back the whole transaction, so there is no savepoint left.
+		// A lock wait timeout only rolls back the failing statement, so the savepoint still has to be rolled back.
+		if !IsDeadlock(ferr) {
+			_, err = tx.tx.ExecContext(tx.ctx, "ROLLBACK TO SAVEPOINT "+name)
+			if err != nil {
+				logger.Log.Warn("rollback to savepoint failed: " + err.Error())
+			}
+		}
+		return ferr
+	}
+	_, err = tx.tx.ExecContext(tx.ctx, "RELEASE SAVEPOINT "+name)
+	if err != nil {
+		return queryError(tx.ctx, err, "RELEASE SAVEPOINT "+name)
+	}
+	return nil
+}
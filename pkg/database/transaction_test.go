@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/fabiokaelin/ferror"
+)
+
+// cacheSize returns the cache_size setting of the connection a query gets
+func cacheSize(t *testing.T, c *Client) int {
+	t.Helper()
+	size, ferr := GetWith[int](context.Background(), c, "PRAGMA cache_size")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	return size
+}
+
+func TestRunInSessionTransaction(t *testing.T) {
+	c := newTestClient(t)
+	// a single connection, so a setting which is not reset would be seen by the next query
+	c.DB().SetMaxOpenConns(1)
+	before := cacheSize(t, c)
+
+	var during int
+	ferr := c.RunInSessionTransaction(context.Background(), nil, "PRAGMA cache_size = 123", "PRAGMA cache_size = "+strconv.Itoa(before), func(tx *Tx) ferror.FError {
+		row, ferr := tx.RunSQLRow("PRAGMA cache_size")
+		if ferr != nil {
+			return ferr
+		}
+		return ferror.FromError(row.Scan(&during))
+	})
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	if during != 123 {
+		t.Errorf("cache_size in the transaction = %d, want 123", during)
+	}
+	if got := cacheSize(t, c); got != before {
+		t.Errorf("cache_size after the transaction = %d, want %d", got, before)
+	}
+}
+
+func TestRunInSessionTransactionDiscardsConnection(t *testing.T) {
+	c := newTestClient(t)
+	c.DB().SetMaxOpenConns(1)
+	before := cacheSize(t, c)
+
+	ferr := c.RunInSessionTransaction(context.Background(), nil, "PRAGMA cache_size = 123", "SELECT * FROM missing", func(tx *Tx) ferror.FError {
+		return nil
+	})
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	if got := cacheSize(t, c); got != before {
+		t.Errorf("cache_size after a failed reset = %d, want %d of a new connection", got, before)
+	}
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/fabiokaelin/ferror"
+)
+
+type (
+	// UUID is an id as defined in RFC 9562. It is stored as BINARY(16) and marshalled to the canonical string
+	// (e.g. "0190a8f2-6c1e-7b3a-9f4d-1c2b3a4d5e6f") in JSON. Scan also accepts the canonical string, so it can be read from CHAR(36) columns,
+	// to write into such a column pass id.String() as parameter.
+	UUID [16]byte
+
+	// OrderedUUID is a UUID stored with swapped time fields like MySQL's UUID_TO_BIN(id, 1), which makes version 1 ids
+	// increase over time and keeps the primary key index compact. Version 7 ids are already time ordered and should use UUID.
+	OrderedUUID UUID
+)
+
+// NewUUID returns a random version 4 id
+func NewUUID() UUID {
+	var u UUID
+	_, _ = rand.Read(u[:]) // crypto/rand does not fail on supported platforms
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// NewUUIDv7 returns a version 7 id, which starts with the current unix time in milliseconds. Ids created later sort after earlier ones,
+// so they are a good fit for primary keys.
+func NewUUIDv7() UUID {
+	var u UUID
+	_, _ = rand.Read(u[6:]) // crypto/rand does not fail on supported platforms
+	milliseconds := uint64(time.Now().UnixMilli())
+	u[0] = byte(milliseconds >> 40)
+	u[1] = byte(milliseconds >> 32)
+	binary.BigEndian.PutUint32(u[2:6], uint32(milliseconds))
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// ParseUUID parses the canonical string of an id, upper case letters are accepted
+func ParseUUID(s string) (UUID, ferror.FError) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, uuidError(s)
+	}
+	// the hex parts of the canonical string: 8-4-4-4-12 characters
+	src := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	_, err := hex.Decode(u[:], []byte(src))
+	if err != nil {
+		return UUID{}, uuidError(s)
+	}
+	return u, nil
+}
+
+// uuidError returns the error for a value which is not a valid id
+func uuidError(value string) ferror.FError {
+	ferr := ferror.New("invalid uuid")
+	ferr.SetLayer("db")
+	ferr.SetKind(KindInvalidUUID)
+	ferr.SetUserMsg("invalid id")
+	ferr.SetInternal(fmt.Sprintf("%q is not a valid uuid", value))
+	return ferr
+}
+
+// String returns the canonical string of the id
+func (u UUID) String() string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf)
+}
+
+// IsZero reports if the id is unset
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// Version returns the version of the id, e.g. 4 for a random and 7 for a time based one
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time returns the creation time of a version 7 id and the zero time for every other version
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+	milliseconds := int64(u[0])<<40 | int64(u[1])<<32 | int64(binary.BigEndian.Uint32(u[2:6]))
+	return time.UnixMilli(milliseconds)
+}
+
+// MarshalText implements encoding.TextMarshaler, it is used for JSON as well
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it is used for JSON as well
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, ferr := ParseUUID(string(text))
+	if ferr != nil {
+		return ferr
+	}
+	*u = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, the id is stored as 16 bytes
+func (u UUID) Value() (driver.Value, error) {
+	return u[:], nil
+}
+
+// Scan implements sql.Scanner. It accepts 16 bytes from a BINARY(16) column and the canonical string from a CHAR(36) column, NULL results in the zero id.
+func (u *UUID) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*u = UUID{}
+		return nil
+	case []byte:
+		if len(src) == 16 {
+			copy(u[:], src)
+			return nil
+		}
+		return u.UnmarshalText(src)
+	case string:
+		return u.UnmarshalText([]byte(src))
+	default:
+		return uuidError(fmt.Sprintf("%v (%T)", src, src))
+	}
+}
+
+// swapTimeFields converts between the RFC layout and the layout of UUID_TO_BIN(id, 1): time_low|time_mid|time_hi <-> time_hi|time_mid|time_low
+func swapTimeFields(u UUID, toOrdered bool) UUID {
+	var swapped UUID
+	if toOrdered {
+		copy(swapped[0:2], u[6:8])
+		copy(swapped[2:4], u[4:6])
+		copy(swapped[4:8], u[0:4])
+	} else {
+		copy(swapped[0:4], u[4:8])
+		copy(swapped[4:6], u[2:4])
+		copy(swapped[6:8], u[0:2])
+	}
+	copy(swapped[8:], u[8:])
+	return swapped
+}
+
+// UUID returns the id in the RFC layout
+func (o OrderedUUID) UUID() UUID {
+	return UUID(o)
+}
+
+// String returns the canonical string of the id
+func (o OrderedUUID) String() string {
+	return UUID(o).String()
+}
+
+// MarshalText implements encoding.TextMarshaler, it is used for JSON as well
+func (o OrderedUUID) MarshalText() ([]byte, error) {
+	return UUID(o).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it is used for JSON as well
+func (o *OrderedUUID) UnmarshalText(text []byte) error {
+	return (*UUID)(o).UnmarshalText(text)
+}
+
+// Value implements driver.Valuer, the id is stored with swapped time fields
+func (o OrderedUUID) Value() (driver.Value, error) {
+	swapped := swapTimeFields(UUID(o), true)
+	return swapped[:], nil
+}
+
+// Scan implements sql.Scanner. 16 bytes are expected in the swapped layout, the canonical string is accepted as well.
+func (o *OrderedUUID) Scan(src any) error {
+	if b, ok := src.([]byte); ok && len(b) == 16 {
+		*o = OrderedUUID(swapTimeFields(UUID(b), false))
+		return nil
+	}
+	return (*UUID)(o).Scan(src)
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/fabiokaelin/ferror"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultVersionColumn is the column VersionedUpdate checks if none is set
+const defaultVersionColumn = "version"
+
+// VersionedUpdate changes a row only if it was not changed since it was read (optimistic locking).
+// The row needs an integer version column which is returned to the client together with the data and sent back on an update:
+//
+//	newVersion, ferr := database.VersionedUpdate{
+//		Table:   "articles",
+//		Set:     map[string]any{"title": body.Title},
+//		Where:   map[string]any{"id": id},
+//		Version: body.Version,
+//	}.Exec(ctx, database.Default())
+//	if ferr != nil {
+//		database.AbortWithError(ctx, ferr) // 409 if someone else saved first
+//		return
+//	}
+type VersionedUpdate struct {
+	Table         string         // table and column names must be valid identifiers, see ValidIdentifier
+	Set           map[string]any // columns to change
+	Where         map[string]any // columns which identify the row, e.g. its id
+	VersionColumn string         // default "version"
+	Version       int64          // version of the row as it was read
+}
+
+// Exec executes the update on q and returns the new version of the row. If the row was changed in the meantime
+// an error of kind KindConflict is returned, if it does not exist anymore one of kind KindNotFound.
+func (u VersionedUpdate) Exec(ctx context.Context, q Querier) (int64, ferror.FError) {
+	// the check after a failed update has to see the row of the primary, a replica may lag behind
+	q = primary(q)
+	versionColumn := u.VersionColumn
+	if versionColumn == "" {
+		versionColumn = defaultVersionColumn
+	}
+	if len(u.Set) == 0 || len(u.Where) == 0 {
+		ferr := ferror.New(fmt.Sprintf("versioned update of %s needs columns to set and a where condition", u.Table))
+		ferr.SetLayer("db")
+		ferr.SetKind(KindExecution)
+		return 0, ferr
+	}
+	ferr := u.validate(versionColumn)
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	parameters := make([]any, 0, len(u.Set)+len(u.Where)+1)
+	assignments := make([]string, 0, len(u.Set)+1)
+	for _, column := range slices.Sorted(maps.Keys(u.Set)) {
+		assignments = append(assignments, column+" = ?")
+		parameters = append(parameters, u.Set[column])
+	}
+	assignments = append(assignments, versionColumn+" = "+versionColumn+" + 1")
+	where, whereParameters := u.where()
+	parameters = append(parameters, whereParameters...)
+	parameters = append(parameters, u.Version)
+
+	query := "UPDATE " + u.Table + " SET " + strings.Join(assignments, ", ") + " WHERE " + where + " AND " + versionColumn + " = ?"
+	result, ferr := exec(ctx, q, query, parameters...)
+	if ferr != nil {
+		return 0, ferr
+	}
+	if result.RowsAffected > 0 {
+		return u.Version + 1, nil
+	}
+
+	// no row matched: either the version is outdated or the row is gone
+	_, ferr = GetWith[int](ctx, q, "SELECT 1 FROM "+u.Table+" WHERE "+where, whereParameters...)
+	if ferr != nil {
+		return 0, ferr
+	}
+	ferr = ferror.New("row was changed in the meantime")
+	ferr.SetLayer("db")
+	ferr.SetKind(KindConflict)
+	ferr.SetUserMsg(conflictMessage)
+	ferr.SetInternal(fmt.Sprintf("version %d of %s is outdated", u.Version, u.Table))
+	return 0, ferr
+}
+
+// validate checks that the table and all column names are valid identifiers
+func (u VersionedUpdate) validate(versionColumn string) ferror.FError {
+	names := append([]string{u.Table, versionColumn}, slices.Sorted(maps.Keys(u.Set))...)
+	names = append(names, slices.Sorted(maps.Keys(u.Where))...)
+	return checkIdentifiers("versioned update of "+u.Table, names...)
+}
+
+// where builds the condition which identifies the row
+func (u VersionedUpdate) where() (string, []any) {
+	conditions := make([]string, 0, len(u.Where))
+	parameters := make([]any, 0, len(u.Where))
+	for _, column := range slices.Sorted(maps.Keys(u.Where)) {
+		conditions = append(conditions, column+" = ?")
+		parameters = append(parameters, u.Where[column])
+	}
+	return strings.Join(conditions, " AND "), parameters
+}
+
+// HTTPStatus returns the status code a handler should respond with for an error of this package
+func HTTPStatus(ferr ferror.FError) int {
+	switch {
+	case ferr == nil:
+		return http.StatusOK
+	case IsConflict(ferr), IsDuplicate(ferr):
+		return http.StatusConflict
+	case IsNotFound(ferr):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// safeMessages are the messages AbortWithError sends for the error kinds whose cause can be told to a client
+var safeMessages = map[string]string{
+	KindNotFound:  notFoundMessage,
+	KindDuplicate: duplicateMessage,
+	KindConflict:  conflictMessage,
+}
+
+// AbortWithError aborts the request with the status code of ferr (e.g. 409 for a conflict) and a message for the client.
+// Only the kinds with a known safe message (not found, duplicate, conflict) send it, all others the status text,
+// because the user message of ferr falls back to the message of the driver.
+func AbortWithError(c *gin.Context, ferr ferror.FError) {
+	status := HTTPStatus(ferr)
+	message := http.StatusText(status)
+	if ferr != nil {
+		if safe, ok := safeMessages[ferr.Kind()]; ok {
+			message = safe
+		}
+	}
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": message,
+	})
+}
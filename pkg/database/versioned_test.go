@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabiokaelin/ferror"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestVersionedUpdate(t *testing.T) {
+	c := newTestClient(t)
+	_, ferr := ExecWith(context.Background(), c, "CREATE TABLE articles (id INTEGER PRIMARY KEY, title TEXT NOT NULL, version INTEGER NOT NULL)")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	_, ferr = ExecWith(context.Background(), c, "INSERT INTO articles (id, title, version) VALUES (1, 'draft', 0)")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	update := func(id int, title string, version int64) (int64, ferror.FError) {
+		return VersionedUpdate{
+			Table:   "articles",
+			Set:     map[string]any{"title": title},
+			Where:   map[string]any{"id": id},
+			Version: version,
+		}.Exec(context.Background(), c)
+	}
+
+	version, ferr := update(1, "first", 0)
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	if version != 1 {
+		t.Errorf("new version = %d, want 1", version)
+	}
+	stored, ferr := GetWith[int64](context.Background(), c, "SELECT version FROM articles WHERE id = 1")
+	if ferr != nil || stored != 1 {
+		t.Errorf("stored version = %d, want 1 (%v)", stored, ferr)
+	}
+
+	// a second writer who read version 0 as well
+	_, ferr = update(1, "second", 0)
+	if !IsConflict(ferr) {
+		t.Errorf("outdated update returned %v, want an error of kind %s", ferr, KindConflict)
+	}
+	title, ferr := GetWith[string](context.Background(), c, "SELECT title FROM articles WHERE id = 1")
+	if ferr != nil || title != "first" {
+		t.Errorf("title = %q after the conflict, want first (%v)", title, ferr)
+	}
+
+	_, ferr = update(2, "missing", 0)
+	if !IsNotFound(ferr) {
+		t.Errorf("update of a missing row returned %v, want an error of kind %s", ferr, KindNotFound)
+	}
+
+	_, ferr = VersionedUpdate{
+		Table: "articles",
+		Set:   map[string]any{"title = 'x', version": 0},
+		Where: map[string]any{"id": 1},
+	}.Exec(context.Background(), c)
+	if ferr == nil || ferr.Kind() != KindExecution {
+		t.Errorf("update with an invalid column returned %v, want an error of kind %s", ferr, KindExecution)
+	}
+}
+
+func TestAbortWithError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	duplicate := queryError(context.Background(), &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'alice@example.com' for key 'users.email'"}, "INSERT INTO users")
+	if duplicate.UserMsg() != duplicateMessage {
+		t.Errorf("user message of a duplicate = %q, want %q", duplicate.UserMsg(), duplicateMessage)
+	}
+	_, notFound := GetWith[string](context.Background(), newTestClient(t), "SELECT name FROM items WHERE id = 42")
+	tests := []struct {
+		name    string
+		ferr    ferror.FError
+		status  int
+		message string
+	}{
+		{"duplicate", duplicate, http.StatusConflict, duplicateMessage},
+		{"not found", notFound, http.StatusNotFound, notFoundMessage},
+		{"execution", queryError(context.Background(), errors.New("Error 1146: Table 'app.secret' doesn't exist"), "SELECT"), http.StatusInternalServerError, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			AbortWithError(c, tt.ferr)
+
+			var body map[string]string
+			err := json.Unmarshal(recorder.Body.Bytes(), &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != tt.status || body["error"] != tt.message {
+				t.Errorf("response %d %q, want %d %q", recorder.Code, body["error"], tt.status, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// Package fixtures loads table rows from YAML or JSON files into the database, for tests as well as development seed data.
+//
+// A file maps table names to their rows:
+//
+//	users:
+//	  - id: 1
+//	    name: alice
+//	  - id: 2
+//	    name: bob
+//	user_roles:
+//	  - user_id: 1
+//	    role: admin
+//
+// Maps and lists inside a row are stored as JSON, e.g. for JSON columns.
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/fabiokaelin/fcommon/pkg/database"
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v3"
+)
+
+// Row is a single row of a table, the keys are the column names
+type Row map[string]any
+
+// Load replaces the content of every table listed in the given files of fsys with the rows of the files.
+// If no file is given, all .yml, .yaml and .json files in the root of fsys are loaded.
+// Everything runs in one transaction with foreign key checks disabled, so the order of the tables does not matter
+// and the database is unchanged if a row can not be inserted.
+func Load(ctx context.Context, c *database.Client, fsys fs.FS, files ...string) ferror.FError {
+	tables, ferr := Read(fsys, files...)
+	if ferr != nil {
+		return ferr
+	}
+	return LoadTables(ctx, c, tables)
+}
+
+// LoadTables replaces the content of the given tables with rows like Load
+func LoadTables(ctx context.Context, c *database.Client, tables map[string][]Row) ferror.FError {
+	names := slices.Sorted(maps.Keys(tables))
+	return withoutForeignKeys(ctx, c, func(tx *database.Tx) ferror.FError {
+		for _, table := range names {
+			ferr := deleteRows(tx, table)
+			if ferr != nil {
+				return ferr
+			}
+			for i, row := range tables[table] {
+				ferr = insertRow(tx, table, row)
+				if ferr != nil {
+					ferr.SetInternal(fmt.Sprintf("error during inserting row %d into %s", i+1, table))
+					return ferr
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Truncate deletes all rows of the given tables, e.g. to clean up between tests
+func Truncate(ctx context.Context, c *database.Client, tables ...string) ferror.FError {
+	return withoutForeignKeys(ctx, c, func(tx *database.Tx) ferror.FError {
+		for _, table := range tables {
+			ferr := deleteRows(tx, table)
+			if ferr != nil {
+				return ferr
+			}
+		}
+		return nil
+	})
+}
+
+// Seed loads the files into the database of the default client. Like Load it deletes all existing rows of every table listed in the files
+// before inserting the rows of the files, so it must never run against a database with real data. It is meant for development data
+// and logs what it loaded.
+func Seed(fsys fs.FS, files ...string) ferror.FError {
+	tables, ferr := Read(fsys, files...)
+	if ferr != nil {
+		return ferr
+	}
+	ferr = LoadTables(context.Background(), database.Default(), tables)
+	if ferr != nil {
+		return ferr
+	}
+	for _, table := range slices.Sorted(maps.Keys(tables)) {
+		logger.Log.Info(fmt.Sprintf("seeded %d rows into %s", len(tables[table]), table))
+	}
+	return nil
+}
+
+// Read parses the given fixture files of fsys (or all fixture files in its root if none is given) and returns the rows per table.
+// Rows of a table which is listed in several files are concatenated.
+func Read(fsys fs.FS, files ...string) (map[string][]Row, ferror.FError) {
+	if len(files) == 0 {
+		entries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return nil, newError(err, "read fixture directory")
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isFixtureFile(entry.Name()) {
+				files = append(files, entry.Name())
+			}
+		}
+	}
+
+	tables := map[string][]Row{}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, newError(err, "read fixture "+file)
+		}
+
+		fileTables := map[string][]Row{}
+		if path.Ext(file) == ".json" {
+			// numbers are kept as strings, so large ids do not lose precision as float64
+			decoder := json.NewDecoder(bytes.NewReader(content))
+			decoder.UseNumber()
+			err = decoder.Decode(&fileTables)
+		} else {
+			err = yaml.Unmarshal(content, &fileTables)
+		}
+		if err != nil {
+			return nil, newError(err, "parse fixture "+file)
+		}
+
+		for table, rows := range fileTables {
+			if !database.ValidIdentifier(table) {
+				return nil, newError(fmt.Errorf("invalid table name %q", table), "parse fixture "+file)
+			}
+			tables[table] = append(tables[table], rows...)
+		}
+	}
+	return tables, nil
+}
+
+// isFixtureFile reports if name has the extension of a fixture file
+func isFixtureFile(name string) bool {
+	switch path.Ext(name) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+// withoutForeignKeys runs fn in a transaction in which foreign keys are not checked
+func withoutForeignKeys(ctx context.Context, c *database.Client, fn database.TxFunc) ferror.FError {
+	db := c.DB()
+	if db == nil {
+		return newError(fmt.Errorf("no db connection"), "load fixtures")
+	}
+	driverName := db.DriverName()
+
+	var setting string
+	deferred := false
+	switch {
+	case sqlx.BindType(driverName) == sqlx.DOLLAR:
+		// reset at the end of the transaction, requires a superuser
+		setting = "SET LOCAL session_replication_role = replica"
+	case driverName == database.DriverSQLite || driverName == "sqlite3":
+		// reset at the end of the transaction, PRAGMA foreign_keys can not be changed inside of one
+		setting = "PRAGMA defer_foreign_keys = ON"
+		deferred = true
+	default:
+		// the setting belongs to the connection, the connection is discarded if it can not be restored
+		return c.RunInSessionTransaction(ctx, nil, "SET FOREIGN_KEY_CHECKS = 0", "SET FOREIGN_KEY_CHECKS = 1", fn)
+	}
+	return c.RunInTransaction(ctx, nil, func(tx *database.Tx) ferror.FError {
+		_, ferr := tx.Exec(setting)
+		if ferr != nil {
+			return ferr
+		}
+		ferr = fn(tx)
+		if ferr != nil || !deferred {
+			return ferr
+		}
+		// a failed COMMIT leaves the transaction of sqlite open, so the foreign keys are checked before to roll back instead
+		return checkForeignKeys(tx)
+	})
+}
+
+// checkForeignKeys returns an error if a row of the transaction violates a foreign key (sqlite only)
+func checkForeignKeys(tx *database.Tx) ferror.FError {
+	rows, ferr := tx.RunSQL("PRAGMA foreign_key_check")
+	if ferr != nil {
+		return ferr
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table string
+		var rowID sql.NullInt64
+		var parent string
+		var index int
+		err := rows.Scan(&table, &rowID, &parent, &index)
+		if err != nil {
+			return newError(err, "check foreign keys")
+		}
+		return newError(fmt.Errorf("row %d of %s references a missing row of %s", rowID.Int64, table, parent), "check foreign keys")
+	}
+	if err := rows.Err(); err != nil {
+		return newError(err, "check foreign keys")
+	}
+	return nil
+}
+
+// deleteRows deletes all rows of table. TRUNCATE is not used because mysql commits the running transaction before it.
+func deleteRows(tx *database.Tx, table string) ferror.FError {
+	if !database.ValidIdentifier(table) {
+		return newError(fmt.Errorf("invalid table name %q", table), "delete rows")
+	}
+	_, ferr := tx.Exec("DELETE FROM " + table)
+	return ferr
+}
+
+// insertRow inserts a single row into table
+func insertRow(tx *database.Tx, table string, row Row) ferror.FError {
+	columns := slices.Sorted(maps.Keys(row))
+	parameters := make([]any, 0, len(columns))
+	for _, column := range columns {
+		if !database.ValidIdentifier(column) {
+			return newError(fmt.Errorf("invalid column name %q", column), "insert into "+table)
+		}
+		value, err := columnValue(row[column])
+		if err != nil {
+			return newError(err, "insert into "+table)
+		}
+		parameters = append(parameters, value)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	_, ferr := tx.Exec("INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") VALUES ("+placeholders+")", parameters...)
+	return ferr
+}
+
+// columnValue converts a value of a fixture file into a query parameter, maps and lists are stored as JSON
+func columnValue(value any) (any, error) {
+	switch value := value.(type) {
+	case Row, map[string]any, []any:
+		content, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(content), nil
+	case json.Number:
+		return value.String(), nil
+	default:
+		return value, nil
+	}
+}
+
+// newError wraps an error of the fixtures package
+func newError(err error, internal string) ferror.FError {
+	ferr := ferror.FromError(err)
+	ferr.SetLayer("fixtures")
+	ferr.SetKind("fixtures")
+	ferr.SetInternal(internal)
+	return ferr
+}
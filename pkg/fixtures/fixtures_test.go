@@ -0,0 +1,127 @@
+package fixtures
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fabiokaelin/fcommon/pkg/database"
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/fcommon/pkg/values"
+	_ "modernc.org/sqlite"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger()
+	os.Exit(m.Run())
+}
+
+// newTestClient connects a client to an in-memory sqlite database with foreign keys and creates a users and a posts table
+func newTestClient(t *testing.T) *database.Client {
+	t.Helper()
+	c := database.NewClient(values.DatabaseValues{
+		Driver:       database.DriverSQLite,
+		DatabaseName: "file:" + t.Name() + "?mode=memory&cache=shared&_pragma=foreign_keys(1)",
+	})
+	ferr := c.Connect(context.Background())
+	if ferr != nil {
+		t.Fatalf("connect: %s", ferr.Error())
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	for _, query := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, settings TEXT)",
+		"CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id), title TEXT NOT NULL)",
+		"INSERT INTO users (id, name) VALUES (99, 'existing')",
+	} {
+		_, ferr = database.ExecWith(context.Background(), c, query)
+		if ferr != nil {
+			t.Fatalf("prepare: %s", ferr.Error())
+		}
+	}
+	return c
+}
+
+func TestLoad(t *testing.T) {
+	c := newTestClient(t)
+	fsys := fstest.MapFS{
+		// posts is loaded before users, the foreign key is only checked at the end of the transaction
+		"posts.yml": {Data: []byte("posts:\n  - id: 1\n    user_id: 2\n    title: hello\n")},
+		"users.json": {Data: []byte(`{"users": [
+			{"id": 1, "name": "alice", "settings": {"theme": "dark"}},
+			{"id": 2, "name": "bob"}
+		]}`)},
+		"README.md": {Data: []byte("not a fixture")},
+	}
+
+	ferr := Load(context.Background(), c, fsys)
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+
+	names, ferr := database.SelectWith[string](context.Background(), c, "SELECT name FROM users ORDER BY id")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Errorf("users = %q, want the rows of the fixture only", names)
+	}
+	settings, ferr := database.GetWith[string](context.Background(), c, "SELECT settings FROM users WHERE id = 1")
+	if ferr != nil || settings != `{"theme":"dark"}` {
+		t.Errorf("settings = %q, want the map stored as JSON (%v)", settings, ferr)
+	}
+	title, ferr := database.GetWith[string](context.Background(), c, "SELECT title FROM posts WHERE user_id = 2")
+	if ferr != nil || title != "hello" {
+		t.Errorf("title = %q, want hello (%v)", title, ferr)
+	}
+}
+
+func TestLoadRollsBack(t *testing.T) {
+	c := newTestClient(t)
+	fsys := fstest.MapFS{
+		"posts.yml": {Data: []byte("posts:\n  - id: 1\n    user_id: 7\n    title: orphan\n")},
+	}
+
+	ferr := Load(context.Background(), c, fsys)
+	if ferr == nil {
+		t.Fatal("loading a post of a missing user succeeded")
+	}
+	count, ferr := database.GetWith[int](context.Background(), c, "SELECT COUNT(*) FROM posts")
+	if ferr != nil || count != 0 {
+		t.Errorf("posts has %d rows after a failed load, want 0 (%v)", count, ferr)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	c := newTestClient(t)
+	ferr := Truncate(context.Background(), c, "users")
+	if ferr != nil {
+		t.Fatal(ferr.Error())
+	}
+	count, ferr := database.GetWith[int](context.Background(), c, "SELECT COUNT(*) FROM users")
+	if ferr != nil || count != 0 {
+		t.Errorf("users has %d rows, want 0 (%v)", count, ferr)
+	}
+}
+
+func TestReadInvalidNames(t *testing.T) {
+	tests := map[string]string{
+		"table":  "users; DROP TABLE users:\n  - id: 1\n",
+		"column": "users:\n  - id: 1\n    \"name) VALUES (1); --\": x\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(t)
+			fsys := fstest.MapFS{"users.yml": {Data: []byte(content)}}
+			ferr := Load(context.Background(), c, fsys)
+			if ferr == nil {
+				t.Fatal("a fixture with an invalid name was loaded")
+			}
+			count, ferr := database.GetWith[int](context.Background(), c, "SELECT COUNT(*) FROM users")
+			if ferr != nil || count != 1 {
+				t.Errorf("users has %d rows, want the existing one (%v)", count, ferr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKeyRequestID is the type for the request id in the context
+type contextKeyRequestID string
+
+const (
+	// RequestIDHeader is the header the request id is read from and sent back in
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the key for the request id in the context
+	RequestIDKey = contextKeyRequestID("requestID")
+)
+
+// requestIDPattern matches the request ids which are accepted from a client, others are replaced with a generated one
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestID returns a middleware which takes the request id from the X-Request-ID header (e.g. set by the ingress)
+// or generates one, stores it in the request context and sends it back in the response header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), RequestIDKey, requestID))
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the request id stored by the RequestID middleware or "" if there is none.
+// ctx can be a *gin.Context or a context derived from its request.
+func GetRequestID(ctx context.Context) string {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return ""
+		}
+		ctx = c.Request.Context()
+	}
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(RequestIDKey).(string)
+	return requestID
+}
+
+// newRequestID generates a random request id
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id) // crypto/rand does not fail on supported platforms
+	return hex.EncodeToString(id)
+}
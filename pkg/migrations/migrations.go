@@ -0,0 +1,437 @@
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiokaelin/fcommon/pkg/logger"
+	"github.com/fabiokaelin/ferror"
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Migration is a single schema change read from a pair of up/down sql files
+	Migration struct {
+		Version  int64  // number in front of the file name
+		Name     string // rest of the file name without direction and extension
+		Up       string // content of the .up.sql file
+		Down     string // content of the .down.sql file, may be empty
+		Checksum string // sha256 of the up file
+	}
+
+	// Applied is a migration recorded in the schema_migrations table
+	Applied struct {
+		Version   int64     `db:"version" json:"version"`
+		Name      string    `db:"name" json:"name"`
+		Checksum  string    `db:"checksum" json:"checksum"`
+		AppliedAt time.Time `db:"applied_at" json:"appliedAt"`
+	}
+)
+
+const (
+	// TableName is the table in which applied migrations are recorded
+	TableName = "schema_migrations"
+	// lockName is the name of the mysql user lock which serializes concurrent runners
+	lockName = "fcommon_schema_migrations"
+	// postgresLockKey is the key of the postgres advisory lock which serializes concurrent runners
+	postgresLockKey = 0x66636f6d6d6f6e // "fcommon"
+	// lockTimeout is how long (in seconds) a runner waits for another runner to finish
+	lockTimeout = 300
+)
+
+// fileNamePattern matches file names like 0001_create_users.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load reads all migrations from the root of fsys and returns them sorted by version
+func Load(fsys fs.FS) ([]Migration, ferror.FError) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, newError(err, "read migration directory")
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, newError(err, "invalid migration version "+entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, newError(err, "read migration "+entry.Name())
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, newError(fmt.Errorf("migration %d has the names %q and %q", version, migration.Name, match[2]), "load migrations")
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, newError(fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name), "load migrations")
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Up applies all pending migrations from fsys
+func Up(ctx context.Context, db *sqlx.DB, fsys fs.FS) ferror.FError {
+	migrations, ferr := Load(fsys)
+	if ferr != nil {
+		return ferr
+	}
+	return withLock(ctx, db, func(conn *sqlx.Conn) ferror.FError {
+		applied, ferr := appliedVersions(ctx, conn)
+		if ferr != nil {
+			return ferr
+		}
+		for _, migration := range migrations {
+			checksum, ok := applied[migration.Version]
+			if ok {
+				if checksum != migration.Checksum {
+					ferr := ferror.New(fmt.Sprintf("checksum of migration %d_%s changed after it was applied", migration.Version, migration.Name))
+					ferr.SetLayer("migrations")
+					ferr.SetKind("migration checksum")
+					return ferr
+				}
+				continue
+			}
+
+			logger.Log.Info(fmt.Sprintf("applying migration %d_%s", migration.Version, migration.Name))
+			ferr := execScript(ctx, conn, migration.Up)
+			if ferr != nil {
+				ferr.SetInternal(fmt.Sprintf("migration %d_%s failed, the database may be partially migrated", migration.Version, migration.Name))
+				return ferr
+			}
+			_, err := conn.ExecContext(ctx, conn.Rebind("INSERT INTO "+TableName+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"), migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+			if err != nil {
+				return newError(err, fmt.Sprintf("record migration %d_%s", migration.Version, migration.Name))
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back the last steps applied migrations using their down files
+func Down(ctx context.Context, db *sqlx.DB, fsys fs.FS, steps int) ferror.FError {
+	migrations, ferr := Load(fsys)
+	if ferr != nil {
+		return ferr
+	}
+	return withLock(ctx, db, func(conn *sqlx.Conn) ferror.FError {
+		applied, ferr := appliedVersions(ctx, conn)
+		if ferr != nil {
+			return ferr
+		}
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(migration.Down) == "" {
+				ferr := ferror.New(fmt.Sprintf("migration %d_%s has no down file", migration.Version, migration.Name))
+				ferr.SetLayer("migrations")
+				ferr.SetKind("migration")
+				return ferr
+			}
+
+			logger.Log.Info(fmt.Sprintf("rolling back migration %d_%s", migration.Version, migration.Name))
+			ferr := execScript(ctx, conn, migration.Down)
+			if ferr != nil {
+				ferr.SetInternal(fmt.Sprintf("rollback of migration %d_%s failed, the database may be partially migrated", migration.Version, migration.Name))
+				return ferr
+			}
+			_, err := conn.ExecContext(ctx, conn.Rebind("DELETE FROM "+TableName+" WHERE version = ?"), migration.Version)
+			if err != nil {
+				return newError(err, fmt.Sprintf("remove migration %d_%s", migration.Version, migration.Name))
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// History returns all migrations recorded in the schema_migrations table. It only reads, if the table does not exist yet the history is empty.
+func History(ctx context.Context, db *sqlx.DB) ([]Applied, ferror.FError) {
+	history := []Applied{}
+	exists, ferr := tableExists(ctx, db)
+	if ferr != nil || !exists {
+		return history, ferr
+	}
+	err := db.SelectContext(ctx, &history, "SELECT version, name, checksum, applied_at FROM "+TableName+" ORDER BY version")
+	if err != nil {
+		return nil, newError(err, "read "+TableName)
+	}
+	return history, nil
+}
+
+// withLock runs fn on a single connection which holds the migration lock, so only one replica migrates at a time
+func withLock(ctx context.Context, db *sqlx.DB, fn func(conn *sqlx.Conn) ferror.FError) ferror.FError {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return newError(err, "get connection")
+	}
+	defer conn.Close()
+
+	ferr := acquireLock(ctx, conn, db.DriverName())
+	if ferr != nil {
+		return ferr
+	}
+	defer releaseLock(conn, db.DriverName())
+
+	ferr = ensureTable(ctx, conn)
+	if ferr != nil {
+		return ferr
+	}
+	return fn(conn)
+}
+
+// acquireLock takes the session lock of the database. sqlite locks the whole file on write, so there is no lock needed.
+func acquireLock(ctx context.Context, conn *sqlx.Conn, driverName string) ferror.FError {
+	var locked sql.NullInt64
+	var err error
+	switch {
+	case sqlx.BindType(driverName) == sqlx.DOLLAR:
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", postgresLockKey)
+		locked = sql.NullInt64{Int64: 1, Valid: err == nil}
+	case driverName == "mysql":
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&locked)
+	default:
+		return nil
+	}
+	if err != nil {
+		return newError(err, "acquire migration lock")
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		ferr := ferror.New("could not acquire migration lock")
+		ferr.SetLayer("migrations")
+		ferr.SetKind("migration lock")
+		return ferr
+	}
+	return nil
+}
+
+// releaseLock releases the lock taken by acquireLock
+func releaseLock(conn *sqlx.Conn, driverName string) {
+	// the lock is bound to the session, use a fresh context so it is released even if the migration context is cancelled
+	var err error
+	switch {
+	case sqlx.BindType(driverName) == sqlx.DOLLAR:
+		_, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", postgresLockKey)
+	case driverName == "mysql":
+		_, err = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	}
+	if err != nil {
+		logger.Log.Warn("release migration lock: " + err.Error())
+	}
+}
+
+// tableExists reports if the schema_migrations table exists in the current database
+func tableExists(ctx context.Context, db *sqlx.DB) (bool, ferror.FError) {
+	var query string
+	switch driverName := db.DriverName(); {
+	case sqlx.BindType(driverName) == sqlx.DOLLAR:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	case driverName == "sqlite" || driverName == "sqlite3":
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	default:
+		query = "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+	}
+	var count int
+	err := db.GetContext(ctx, &count, query, TableName)
+	if err != nil {
+		return false, newError(err, "check if "+TableName+" exists")
+	}
+	return count > 0, nil
+}
+
+// ensureTable creates the schema_migrations table if it does not exist
+func ensureTable(ctx context.Context, db sqlx.ExecerContext) ferror.FError {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+TableName+` (
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`)
+	if err != nil {
+		return newError(err, "create "+TableName)
+	}
+	return nil
+}
+
+// appliedVersions returns the checksums of all applied migrations by version
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int64]string, ferror.FError) {
+	history := []Applied{}
+	err := conn.SelectContext(ctx, &history, "SELECT version, name, checksum, applied_at FROM "+TableName)
+	if err != nil {
+		return nil, newError(err, "read "+TableName)
+	}
+	applied := make(map[int64]string, len(history))
+	for _, migration := range history {
+		applied[migration.Version] = migration.Checksum
+	}
+	return applied, nil
+}
+
+// execScript executes all statements of a migration file one after another
+func execScript(ctx context.Context, conn *sqlx.Conn, script string) ferror.FError {
+	for i, statement := range splitStatements(script) {
+		_, err := conn.ExecContext(ctx, statement)
+		if err != nil {
+			ferr := newError(err, fmt.Sprintf("statement %d", i+1))
+			ferr.SetKind("migration execution")
+			return ferr
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a sql script on semicolons which are not inside quotes or comments. Block comments are kept in the statements, line comments are removed.
+// Like the mysql client it understands the DELIMITER directive, which is needed for triggers and procedures whose body contains semicolons:
+//
+//	DELIMITER //
+//	CREATE TRIGGER users_updated BEFORE UPDATE ON users FOR EACH ROW BEGIN
+//		SET NEW.updated_at = NOW();
+//		SET NEW.version = OLD.version + 1;
+//	END//
+//	DELIMITER ;
+func splitStatements(script string) []string {
+	statements := []string{}
+	current := strings.Builder{}
+	hasContent := false
+	delimiter := ";"
+	// lineBlank is true while only whitespace was read since the last line break, a directive has to start a line
+	lineBlank := true
+	flush := func() {
+		if hasContent {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		hasContent = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case lineBlank && isDelimiterDirective(script[i:]):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			fields := strings.Fields(script[i : i+end])
+			flush()
+			if len(fields) > 1 {
+				delimiter = fields[1]
+			}
+			i += end
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(script) && script[end] != c {
+				if script[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			end = min(end, len(script)-1)
+			current.WriteString(script[i : end+1])
+			hasContent = true
+			lineBlank = false
+			i = end
+		case c == '#' || isDashComment(script[i:]):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+				current.WriteByte('\n')
+				lineBlank = true
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			// the comment is kept, it may be a mysql executable comment (/*!40101 ... */), an optimizer hint (/*+ ... */)
+			// or separate two tokens (SELECT 1/*x*/FROM t). Only executable comments and hints make a statement on their own.
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i + 4
+			}
+			current.WriteString(script[i:end])
+			if strings.HasPrefix(script[i:], "/*!") || strings.HasPrefix(script[i:], "/*+") {
+				hasContent = true
+			}
+			lineBlank = false
+			i = end - 1
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter) - 1
+			lineBlank = false
+		default:
+			current.WriteByte(c)
+			switch c {
+			case '\n':
+				lineBlank = true
+			case ' ', '\t', '\r':
+			default:
+				hasContent = true
+				lineBlank = false
+			}
+		}
+	}
+	flush()
+	return statements
+}
+
+// isDelimiterDirective reports if s starts with a DELIMITER directive
+func isDelimiterDirective(s string) bool {
+	const keyword = "DELIMITER"
+	return len(s) > len(keyword) && strings.EqualFold(s[:len(keyword)], keyword) && (s[len(keyword)] == ' ' || s[len(keyword)] == '\t')
+}
+
+// isDashComment reports if s starts with a -- comment, which mysql only accepts if the dashes are followed by whitespace or the end of the script
+func isDashComment(s string) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || s[2] == ' ' || s[2] == '\t' || s[2] == '\n' || s[2] == '\r'
+}
+
+// newError creates a ferror for the migrations layer
+func newError(err error, internal string) ferror.FError {
+	ferr := ferror.FromError(err)
+	ferr.SetLayer("migrations")
+	ferr.SetKind("migration")
+	ferr.SetInternal(internal)
+	return ferr
+}
@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "single statement without semicolon",
+			script: "CREATE TABLE a (id INT)",
+			want:   []string{"CREATE TABLE a (id INT)"},
+		},
+		{
+			name:   "several statements",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "empty statements are skipped",
+			script: ";;\n  ;\nSELECT 1;;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "semicolons in quotes",
+			script: "INSERT INTO a VALUES ('x;y', \"a;b\");\nSELECT `we;ird` FROM a;",
+			want:   []string{"INSERT INTO a VALUES ('x;y', \"a;b\")", "SELECT `we;ird` FROM a"},
+		},
+		{
+			name:   "escaped quote",
+			script: `INSERT INTO a VALUES ('it\'s; fine');SELECT 1`,
+			want:   []string{`INSERT INTO a VALUES ('it\'s; fine')`, "SELECT 1"},
+		},
+		{
+			name:   "dash comment with space",
+			script: "-- create a; not split\nSELECT 1;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "dash comment without text",
+			script: "--\nSELECT 1;\nSELECT 2; --",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "dashes without whitespace are not a comment",
+			script: "SELECT 1--2;",
+			want:   []string{"SELECT 1--2"},
+		},
+		{
+			name:   "hash comment",
+			script: "# comment; here\nSELECT 1;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "block comment",
+			script: "/* a; b */ SELECT 1; /* trailing */",
+			want:   []string{"/* a; b */ SELECT 1"},
+		},
+		{
+			name:   "mysql executable comment",
+			script: "/*!40101 SET NAMES utf8mb4 */;\nSELECT 1;",
+			want:   []string{"/*!40101 SET NAMES utf8mb4 */", "SELECT 1"},
+		},
+		{
+			name:   "optimizer hint",
+			script: "SELECT /*+ MAX_EXECUTION_TIME(1000) */ id FROM t;",
+			want:   []string{"SELECT /*+ MAX_EXECUTION_TIME(1000) */ id FROM t"},
+		},
+		{
+			name:   "block comment between tokens",
+			script: "SELECT 1/*x*/FROM t;",
+			want:   []string{"SELECT 1/*x*/FROM t"},
+		},
+		{
+			name:   "unterminated block comment",
+			script: "SELECT 1 /* open; still comment",
+			want:   []string{"SELECT 1 /* open; still comment"},
+		},
+		{
+			name: "trigger with delimiter",
+			script: "CREATE TABLE a (id INT, v INT);\n" +
+				"DELIMITER //\n" +
+				"CREATE TRIGGER a_v BEFORE UPDATE ON a FOR EACH ROW BEGIN\n" +
+				"  SET NEW.v = OLD.v + 1;\n" +
+				"  SET NEW.id = OLD.id;\n" +
+				"END//\n" +
+				"DELIMITER ;\n" +
+				"SELECT 1;",
+			want: []string{
+				"CREATE TABLE a (id INT, v INT)",
+				"CREATE TRIGGER a_v BEFORE UPDATE ON a FOR EACH ROW BEGIN\n  SET NEW.v = OLD.v + 1;\n  SET NEW.id = OLD.id;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			name:   "delimiter directive is case insensitive and only valid at line start",
+			script: "delimiter $$\nSELECT 'DELIMITER x'; SELECT 2$$\n  DELIMITER ;\nSELECT 3;",
+			want:   []string{"SELECT 'DELIMITER x'; SELECT 2", "SELECT 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements(%q)\n got: %q\nwant: %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
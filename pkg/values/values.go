@@ -1,5 +1,7 @@
 package values
 
+import "time"
+
 type (
 	Values struct {
 		GinMode              string
@@ -14,11 +16,45 @@ type (
 	}
 
 	DatabaseValues struct {
-		DatabaseUser     string
-		DatabasePassword string
-		DatabaseHost     string
-		DatabasePort     string
-		DatabaseName     string
+		Driver             string // database/sql driver name: "mysql" (default), "postgres"/"pgx" or "sqlite"/"sqlite3"
+		DatabaseUser       string
+		DatabasePassword   string
+		PasswordFile       string // path of a file containing the password (e.g. a mounted secret), it overrides DatabasePassword and is watched for changes
+		DatabaseHost       string
+		DatabasePort       string
+		DatabaseName       string        // for sqlite the path of the database file
+		ReplicaHosts       []string      // optional read replicas as "host" or "host:port", the port defaults to DatabasePort
+		QueryTimeout       time.Duration // default timeout for a single query, 0 disables it
+		SlowQueryThreshold time.Duration // queries which take longer are logged as warning, 0 disables it. For RunSQL only the time until the rows are returned is measured.
+		ConnectRetry       RetryValues   // retry policy for the initial connection
+		HealthInterval     time.Duration // time between two pings of the health check, default 5m
+		HealthJitter       float64       // random part of the health check interval as fraction (0.1 = ±10%), default 0
+		PasswordInterval   time.Duration // time between two checks of PasswordFile, default 30s
+		QueryComments      bool          // append a sqlcommenter comment with route, request id and version to every statement
+
+		// connection options of the mysql driver, the TLS options are used for postgres as well
+		Socket        string        // path of a unix socket, used instead of DatabaseHost and DatabasePort
+		TLS           string        // "true", "skip-verify" or "preferred", empty disables TLS unless TLSCAFile or TLSCertFile is set. For postgres it is mapped to sslmode, which may also be set directly (e.g. "verify-ca")
+		TLSCAFile     string        // PEM bundle of the CA certificates which are trusted for the server certificate
+		TLSCertFile   string        // PEM client certificate, requires TLSKeyFile
+		TLSKeyFile    string        // PEM key of the client certificate
+		TLSServerName string        // name which is verified against the server certificate, default DatabaseHost
+		Charset       string        // connection charset, e.g. "utf8mb4"
+		Collation     string        // connection collation, default of the driver is "utf8mb4_general_ci"
+		TimeZone      string        // IANA name of the location used for DATETIME and TIMESTAMP values, default UTC
+		DialTimeout   time.Duration // timeout for establishing a connection, 0 uses the default of the OS
+		ReadTimeout   time.Duration // I/O read timeout of a connection, 0 disables it
+		WriteTimeout  time.Duration // I/O write timeout of a connection, 0 disables it
+	}
+
+	// RetryValues configures how often and how long a failed connection is retried, zero values fall back to the defaults
+	RetryValues struct {
+		MaxAttempts    int           // number of attempts including the first one, default 5
+		InitialBackoff time.Duration // wait after the first failed attempt, default 1s
+		MaxBackoff     time.Duration // upper limit for a single wait, default 1m
+		Multiplier     float64       // factor by which the wait grows after each attempt, default 2 (waits of 1s, 2s, 4s and 8s)
+		Jitter         float64       // random part of each wait as fraction (0.2 = ±20%), default 0.1, a negative value disables it
+		Deadline       time.Duration // overall time limit for all attempts, 0 means no limit
 	}
 )
 